@@ -1,7 +1,26 @@
 package main
 
-import "dilidili/pkg/gui"
+import (
+	"os"
+
+	"dilidili/pkg/cli"
+	"dilidili/pkg/gui"
+	"dilidili/pkg/instance"
+)
 
 func main() {
+	args := os.Args[1:]
+	// 浏览器通过 dilidili:// 链接启动：交给已运行的窗口，没有时自己打开窗口
+	if len(args) > 0 && instance.IsSchemeURL(args[0]) {
+		if err := instance.Send(args); err == nil {
+			return
+		}
+		gui.Run(args...)
+		return
+	}
+	// 带参数时以命令行模式运行，否则启动图形界面
+	if len(args) > 0 {
+		os.Exit(cli.Run(args))
+	}
 	gui.Run()
 }
@@ -2,53 +2,306 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+
+	"dilidili/pkg/retry"
+	"dilidili/pkg/utils"
 )
 
 type VideoInfo struct {
-	Code int `json:"code"`
-	Data struct {
-		Title string `json:"title"`
-		Cid   int    `json:"cid"`
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	Data    VideoData `json:"data"`
+}
+
+// VideoData 视频详情接口（view）返回的稿件信息
+type VideoData struct {
+	Ref       utils.VideoRef `json:"-"` // 获取信息时使用的引用，课堂剧集和单曲的 Bvid 为 Ref.Key()
+	Bvid      string         `json:"bvid"`
+	Aid       int64          `json:"aid"`
+	Videos    int            `json:"videos"` // 分 P 数
+	Title     string         `json:"title"`
+	Cid       int            `json:"cid"`
+	Pic       string         `json:"pic"`
+	Desc      string         `json:"desc"`
+	Dynamic   string         `json:"dynamic"` // 投稿时的动态文字
+	Tid       int            `json:"tid"`
+	Tname     string         `json:"tname"`
+	Copyright int            `json:"copyright"` // 1 自制，2 转载
+	Pubdate   int64          `json:"pubdate"`
+	Ctime     int64          `json:"ctime"` // 投稿时间
+	Duration  int            `json:"duration"`
+	Owner     struct {
+		Mid  int64  `json:"mid"`
+		Name string `json:"name"`
+		Face string `json:"face"`
+	} `json:"owner"`
+	Staff []struct {
+		Mid   int64  `json:"mid"`
+		Title string `json:"title"` // 职责，如"UP主"、"剪辑"
+		Name  string `json:"name"`
+		Face  string `json:"face"`
+	} `json:"staff,omitempty"` // 联合投稿的成员
+	Stat      VideoStat   `json:"stat"`
+	Rights    VideoRights `json:"rights"`
+	Dimension Dimension   `json:"dimension"`
+	Pages     []Page      `json:"pages"`
+}
+
+// VideoStat 获取视频信息时的播放、互动数据
+type VideoStat struct {
+	View     int64 `json:"view"`
+	Danmaku  int64 `json:"danmaku"`
+	Reply    int64 `json:"reply"`
+	Favorite int64 `json:"favorite"`
+	Coin     int64 `json:"coin"`
+	Share    int64 `json:"share"`
+	Like     int64 `json:"like"`
+	HisRank  int   `json:"his_rank"` // 历史最高排名，未上榜为 0
+}
+
+// VideoRights 稿件的属性标志，取值为 0 或 1
+type VideoRights struct {
+	Download      int `json:"download"`
+	Movie         int `json:"movie"`
+	Pay           int `json:"pay"`
+	HD5           int `json:"hd5"`
+	NoReprint     int `json:"no_reprint"` // 禁止转载
+	UGCPay        int `json:"ugc_pay"`    // 付费稿件
+	IsCooperation int `json:"is_cooperation"`
+	IsSteinGate   int `json:"is_stein_gate"` // 互动视频
+	Is360         int `json:"is_360"`        // 全景视频
+}
+
+// Dimension 视频的分辨率，Rotate 为 1 时宽高需要对调
+type Dimension struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	Rotate int `json:"rotate"`
+}
+
+// Interactive 判断是否为互动视频
+func (v *VideoInfo) Interactive() bool {
+	return v.Data.Rights.IsSteinGate == 1
+}
+
+// Page 多 P 视频中的一个分 P
+type Page struct {
+	Cid        int       `json:"cid"`
+	Page       int       `json:"page"`
+	Part       string    `json:"part"`
+	Duration   int       `json:"duration"`
+	FirstFrame string    `json:"first_frame"`
+	Dimension  Dimension `json:"dimension"`
+}
+
+type videoTagsResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    []struct {
+		TagName string `json:"tag_name"`
 	} `json:"data"`
 }
 
 type PlayURLResponse struct {
-	Data struct {
-		Dash struct {
-			Video []struct {
-				BaseURL string `json:"baseUrl"`
-			} `json:"video"`
-			Audio []struct {
-				BaseURL string `json:"baseUrl"`
-			} `json:"audio"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Quality    int           `json:"quality"`    // 返回的清晰度代码
+		Format     string        `json:"format"`     // 如 flv、flv720、mp4，只提供 durl 时用于判断分段格式
+		Timelength int           `json:"timelength"` // 所请求分 P 的时长（毫秒）
+		Durl       []DurlSegment `json:"durl"`       // 旧式 FLV/MP4 分段，没有 DASH 流时返回
+		Dash       struct {
+			Video []DashStream `json:"video"`
+			Audio []DashStream `json:"audio"`
+			Dolby struct {
+				Type  int          `json:"type"`
+				Audio []DashStream `json:"audio"`
+			} `json:"dolby"`
+			Flac *struct {
+				Display bool        `json:"display"`
+				Audio   *DashStream `json:"audio"`
+			} `json:"flac"`
 		} `json:"dash"`
 	} `json:"data"`
 }
 
-// GetVideoInfo 获取视频标题和 cid
+// DashStream DASH 的一路视频或音频流
+type DashStream struct {
+	ID        int    `json:"id"`
+	BaseURL   string `json:"baseUrl"`
+	Codecs    string `json:"codecs"`
+	Bandwidth int    `json:"bandwidth"`
+}
+
+// AudioStreams 返回所有可用的音频流，包括普通音频、杜比音频和 Hi-Res 无损音频
+func (r *PlayURLResponse) AudioStreams() []DashStream {
+	streams := append([]DashStream(nil), r.Data.Dash.Audio...)
+	streams = append(streams, r.Data.Dash.Dolby.Audio...)
+	if flac := r.Data.Dash.Flac; flac != nil && flac.Audio != nil && flac.Audio.BaseURL != "" {
+		streams = append(streams, *flac.Audio)
+	}
+	return streams
+}
+
+// DurlSegment 旧式播放地址中的一个分段，音视频已合在一起，按顺序拼接即为完整视频
+type DurlSegment struct {
+	Order     int      `json:"order"`
+	Length    int64    `json:"length"` // 时长（毫秒）
+	Size      int64    `json:"size"`
+	URL       string   `json:"url"`
+	BackupURL []string `json:"backup_url"`
+}
+
+// GetRefInfo 获取引用指向的视频信息，课堂剧集和单曲分别转交 GetCheeseVideoInfo 和 GetSongVideoInfo
+func GetRefInfo(ref utils.VideoRef) (*VideoInfo, error) {
+	switch ref.Kind {
+	case utils.KindCheese:
+		return GetCheeseVideoInfo(ref.NumID())
+	case utils.KindSong:
+		return GetSongVideoInfo(ref.NumID())
+	case utils.KindMenu:
+		return nil, errors.New("音频歌单需要通过批量导入展开为单曲")
+	}
+	return GetVideoInfo(ref.ID)
+}
+
+// GetVideoInfo 获取投稿视频的标题和 cid
 func GetVideoInfo(bvid string) (*VideoInfo, error) {
 	url := fmt.Sprintf("https://api.bilibili.com/x/web-interface/view?bvid=%s", bvid)
-	resp, err := http.Get(url)
+	resp, err := apiClient().Get(url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := retry.CheckStatus(resp); err != nil {
+		return nil, err
+	}
 
 	var result VideoInfo
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
 	if result.Code != 0 {
-		return nil, fmt.Errorf("API 返回错误，代码: %d", result.Code)
+		return nil, &APIError{Code: result.Code, Message: result.Message}
+	}
+	result.Data.Ref = utils.VideoRef{ID: bvid}
+	return &result, nil
+}
+
+// GetVideoTags 获取视频的标签列表
+func GetVideoTags(bvid string) ([]string, error) {
+	url := fmt.Sprintf("https://api.bilibili.com/x/tag/archive/tags?bvid=%s", bvid)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	req.Header.Set("Referer", VideoURL(bvid))
+
+	resp, err := apiClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := retry.CheckStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var result videoTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Code != 0 {
+		return nil, &APIError{Code: result.Code, Message: result.Message}
+	}
+	tags := make([]string, 0, len(result.Data))
+	for _, t := range result.Data {
+		tags = append(tags, t.TagName)
+	}
+	return tags, nil
+}
+
+// ViewPoint 视频分段章节，From/To 单位为秒
+type ViewPoint struct {
+	Type    int    `json:"type"`
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	Content string `json:"content"`
+	ImgURL  string `json:"imgUrl"`
+}
+
+type playerInfoResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		ViewPoints  []ViewPoint `json:"view_points"`
+		Interaction struct {
+			GraphVersion int64 `json:"graph_version"`
+		} `json:"interaction"`
+	} `json:"data"`
+}
+
+// GetViewPoints 获取视频的分段章节，没有章节时返回空切片
+func GetViewPoints(bvid string, cid int) ([]ViewPoint, error) {
+	result, err := getPlayerInfo(bvid, cid)
+	if err != nil {
+		return nil, err
+	}
+	return result.Data.ViewPoints, nil
+}
+
+// getPlayerInfo 请求播放器信息，其中包含章节和互动视频的剧情图版本
+func getPlayerInfo(bvid string, cid int) (*playerInfoResponse, error) {
+	url := fmt.Sprintf("https://api.bilibili.com/x/player/v2?bvid=%s&cid=%d", bvid, cid)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	req.Header.Set("Referer", "https://www.bilibili.com/")
+
+	resp, err := apiClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := retry.CheckStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var result playerInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Code != 0 {
+		return nil, &APIError{Code: result.Code, Message: result.Message}
 	}
 	return &result, nil
 }
 
-// GetPlayURL 获取视频和音频的 URL
-func GetPlayURL(bvid string, cid int) (*PlayURLResponse, error) {
-	url := fmt.Sprintf("https://api.bilibili.com/x/player/playurl?bvid=%s&cid=%d&qn=80&fnval=80", bvid, cid)
+// OriginalImageURL 去掉图片地址中的 @ 缩放参数并补全协议，得到原图地址
+func OriginalImageURL(url string) string {
+	if i := strings.Index(url, "@"); i >= 0 {
+		url = url[:i]
+	}
+	if strings.HasPrefix(url, "//") {
+		url = "https:" + url
+	}
+	return strings.Replace(url, "http://", "https://", 1)
+}
+
+// VideoURL 返回投稿视频在 B 站的页面地址
+func VideoURL(bvid string) string {
+	return "https://www.bilibili.com/video/" + bvid
+}
+
+// GetPlayURL 获取视频和音频的 URL，qn 为期望的清晰度代码
+func GetPlayURL(bvid string, cid int, qn int) (*PlayURLResponse, error) {
+	url := fmt.Sprintf("https://api.bilibili.com/x/player/playurl?bvid=%s&cid=%d&qn=%d&fnval=%d&fnver=0&fourk=1", bvid, cid, qn, FnvalAll)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -56,16 +309,21 @@ func GetPlayURL(bvid string, cid int) (*PlayURLResponse, error) {
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
 	req.Header.Set("Referer", "https://www.bilibili.com/")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := playURLClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := retry.CheckStatus(resp); err != nil {
+		return nil, err
+	}
 
 	var result PlayURLResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
+	if result.Code != 0 {
+		return nil, &APIError{Code: result.Code, Message: result.Message}
+	}
 	return &result, nil
 }
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"dilidili/pkg/utils"
+)
+
+// 音频区的音质类型
+const (
+	SongQualityPreview = -1 // 仅能试听的片段
+	SongQuality128K    = 0
+	SongQuality192K    = 1
+	SongQuality320K    = 2
+	SongQualityFLAC    = 3 // 无损
+)
+
+// Song 音频区的一首单曲
+type Song struct {
+	ID       int64  `json:"id"`
+	UID      int64  `json:"uid"`
+	Uname    string `json:"uname"`  // 上传者
+	Author   string `json:"author"` // 歌手
+	Title    string `json:"title"`
+	Cover    string `json:"cover"`
+	Intro    string `json:"intro"`
+	Lyric    string `json:"lyric"` // LRC 歌词地址，没有歌词时为空
+	Duration int    `json:"duration"`
+	Passtime int64  `json:"passtime"` // 发布时间
+	Aid      int64  `json:"aid"`
+	Bvid     string `json:"bvid"`
+	Cid      int    `json:"cid"`
+}
+
+// Artist 返回歌手，未填写时返回上传者
+func (s *Song) Artist() string {
+	if s.Author != "" {
+		return s.Author
+	}
+	return s.Uname
+}
+
+// SongStream 单曲的音频流地址
+type SongStream struct {
+	Type      int      `json:"type"` // 实际返回的音质，见 SongQuality 常量
+	Size      int64    `json:"size"`
+	URLs      []string `json:"cdns"`
+	Qualities []struct {
+		Type int    `json:"type"`
+		Desc string `json:"desc"`
+	} `json:"qualities"`
+}
+
+// QualityDesc 返回实际音质的说明，如"无损 FLAC"
+func (s *SongStream) QualityDesc() string {
+	for _, q := range s.Qualities {
+		if q.Type == s.Type {
+			return q.Desc
+		}
+	}
+	return fmt.Sprintf("音质 %d", s.Type)
+}
+
+// ErrSongPreview 音频只提供试听片段，通常是付费音乐
+var ErrSongPreview = errors.New("该音频只提供试听片段")
+
+// audioGet 请求音频区接口，Referer 为音频页
+func audioGet(client *http.Client, url string, sid int64, data any) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Referer", fmt.Sprintf("https://www.bilibili.com/audio/au%d", sid))
+	return liveDo(client, req, data)
+}
+
+// GetSong 获取单曲信息
+func GetSong(sid int64) (*Song, error) {
+	var song Song
+	if err := audioGet(apiClient(), fmt.Sprintf("https://www.bilibili.com/audio/music-service-c/web/song/info?sid=%d", sid), sid, &song); err != nil {
+		return nil, err
+	}
+	if song.ID == 0 {
+		return nil, &APIError{Code: -404, Message: fmt.Sprintf("音频 au%d 不存在", sid)}
+	}
+	return &song, nil
+}
+
+// GetSongVideoInfo 将单曲转换为 VideoInfo，以便沿用命名、媒体库等流程
+func GetSongVideoInfo(sid int64) (*VideoInfo, error) {
+	song, err := GetSong(sid)
+	if err != nil {
+		return nil, err
+	}
+	var info VideoInfo
+	d := &info.Data
+	d.Ref = utils.VideoRef{Kind: utils.KindSong, ID: strconv.FormatInt(sid, 10)}
+	d.Bvid = d.Ref.Key()
+	d.Aid = song.Aid
+	d.Cid = song.Cid
+	d.Title = song.Title
+	d.Pic = song.Cover
+	d.Desc = song.Intro
+	d.Tname = "音频"
+	d.Pubdate = song.Passtime
+	d.Duration = song.Duration
+	d.Owner.Mid = song.UID
+	d.Owner.Name = song.Uname
+	d.Pages = []Page{{Cid: song.Cid, Page: 1, Part: song.Title, Duration: song.Duration}}
+	return &info, nil
+}
+
+// GetSongStream 获取单曲的音频流，quality 为期望的音质，服务器按账号权限返回不超过它的最高音质。
+// 只有试听片段时返回 ErrSongPreview
+func GetSongStream(sid int64, quality int) (*SongStream, error) {
+	url := fmt.Sprintf("https://api.bilibili.com/audio/music-service-c/url?songid=%d&quality=%d&privilege=2&mid=0&platform=android", sid, quality)
+	var stream SongStream
+	if err := audioGet(playURLClient(), url, sid, &stream); err != nil {
+		return nil, err
+	}
+	if stream.Type == SongQualityPreview {
+		return nil, ErrSongPreview
+	}
+	if len(stream.URLs) == 0 {
+		return nil, errors.New("未找到音频流")
+	}
+	return &stream, nil
+}
+
+// GetAudioMenu 获取歌单的标题和全部单曲
+func GetAudioMenu(menuID int64) (string, []Song, error) {
+	var info struct {
+		Title string `json:"title"`
+	}
+	if err := audioGet(apiClient(), fmt.Sprintf("https://www.bilibili.com/audio/music-service-c/web/menu/info?sid=%d", menuID), menuID, &info); err != nil {
+		return "", nil, err
+	}
+	var songs []Song
+	for page := 1; ; page++ {
+		var data struct {
+			PageCount int    `json:"pageCount"`
+			Data      []Song `json:"data"`
+		}
+		url := fmt.Sprintf("https://www.bilibili.com/audio/music-service-c/web/song/of-menu?sid=%d&pn=%d&ps=100", menuID, page)
+		if err := audioGet(apiClient(), url, menuID, &data); err != nil {
+			return "", nil, err
+		}
+		songs = append(songs, data.Data...)
+		if page >= data.PageCount || len(data.Data) == 0 {
+			break
+		}
+	}
+	return info.Title, songs, nil
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"dilidili/pkg/utils"
+)
+
+// ErrNotPurchased 课堂剧集需要购买后才能观看。未设置 Cookie，或 Cookie 对应的账号没有购买该课程
+var ErrNotPurchased = errors.New("需要购买课程后才能下载，请确认已在设置中填写购买账号的 Cookie")
+
+// CheeseEpisode 课程中的一集
+type CheeseEpisode struct {
+	ID          int64  `json:"id"` // 剧集编号 ep_id
+	Aid         int64  `json:"aid"`
+	Cid         int    `json:"cid"`
+	Title       string `json:"title"`
+	Index       int    `json:"index"` // 在课程中的序号，从 1 开始
+	Duration    int    `json:"duration"`
+	Cover       string `json:"cover"`
+	ReleaseDate int64  `json:"release_date"`
+	Status      int    `json:"status"` // 1 可以观看（试看或已购买），其他值需要购买
+}
+
+// Playable 判断当前账号能否观看该集
+func (e CheeseEpisode) Playable() bool {
+	return e.Status == 1
+}
+
+// CheeseSeason 课程信息和剧集列表
+type CheeseSeason struct {
+	SeasonID int64  `json:"season_id"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	Cover    string `json:"cover"`
+	UpInfo   struct {
+		Mid    int64  `json:"mid"`
+		Uname  string `json:"uname"`
+		Avatar string `json:"avatar"`
+	} `json:"up_info"`
+	UserStatus struct {
+		Payed int `json:"payed"`
+	} `json:"user_status"`
+	Episodes []CheeseEpisode `json:"episodes"`
+}
+
+// Purchased 判断当前账号是否已购买课程
+func (s *CheeseSeason) Purchased() bool {
+	return s.UserStatus.Payed == 1
+}
+
+// Episode 按剧集编号查找
+func (s *CheeseSeason) Episode(epID int64) (*CheeseEpisode, bool) {
+	for i := range s.Episodes {
+		if s.Episodes[i].ID == epID {
+			return &s.Episodes[i], true
+		}
+	}
+	return nil, false
+}
+
+// CheeseURL 返回课堂剧集的播放页地址
+func CheeseURL(epID int64) string {
+	return fmt.Sprintf("https://www.bilibili.com/cheese/play/ep%d", epID)
+}
+
+// cheeseGet 请求课堂（pugv）接口，Referer 为剧集播放页
+func cheeseGet(client *http.Client, url string, epID int64, data any) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Referer", CheeseURL(epID))
+	return liveDo(client, req, data)
+}
+
+// GetCheeseSeason 获取剧集所在课程的信息和全部剧集
+func GetCheeseSeason(epID int64) (*CheeseSeason, error) {
+	var season CheeseSeason
+	if err := cheeseGet(apiClient(), fmt.Sprintf("https://api.bilibili.com/pugv/view/web/season?ep_id=%d", epID), epID, &season); err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetCheeseVideoInfo 将课堂剧集转换为 VideoInfo，以便沿用普通视频的下载、命名和元数据流程。
+// 标题为"课程名 - 序号. 剧集标题"，分 P 只有该集本身；未购买时返回 ErrNotPurchased
+func GetCheeseVideoInfo(epID int64) (*VideoInfo, error) {
+	season, err := GetCheeseSeason(epID)
+	if err != nil {
+		return nil, err
+	}
+	ep, ok := season.Episode(epID)
+	if !ok {
+		return nil, &APIError{Code: -404, Message: fmt.Sprintf("课程中没有剧集 ep%d", epID)}
+	}
+	if !ep.Playable() {
+		return nil, fmt.Errorf("《%s》第 %d 集: %w", season.Title, ep.Index, ErrNotPurchased)
+	}
+
+	var info VideoInfo
+	d := &info.Data
+	d.Ref = utils.VideoRef{Kind: utils.KindCheese, ID: strconv.FormatInt(epID, 10)}
+	d.Bvid = d.Ref.Key()
+	d.Aid = ep.Aid
+	d.Cid = ep.Cid
+	d.Title = fmt.Sprintf("%s - %d. %s", season.Title, ep.Index, ep.Title)
+	d.Desc = season.Subtitle
+	d.Tname = "课堂"
+	d.Pubdate = ep.ReleaseDate
+	d.Duration = ep.Duration
+	d.Pic = ep.Cover
+	if d.Pic == "" {
+		d.Pic = season.Cover
+	}
+	d.Owner.Mid = season.UpInfo.Mid
+	d.Owner.Name = season.UpInfo.Uname
+	d.Owner.Face = season.UpInfo.Avatar
+	d.Pages = []Page{{Cid: ep.Cid, Page: 1, Part: ep.Title, Duration: ep.Duration}}
+	return &info, nil
+}
+
+// GetCheesePlayURL 获取课堂剧集的播放地址，返回结构与 GetPlayURL 相同
+func GetCheesePlayURL(epID, aid int64, cid int, qn int) (*PlayURLResponse, error) {
+	url := fmt.Sprintf("https://api.bilibili.com/pugv/player/web/playurl?avid=%d&cid=%d&ep_id=%d&qn=%d&fnval=%d&fnver=0&fourk=1",
+		aid, cid, epID, qn, FnvalAll)
+	var result PlayURLResponse
+	if err := cheeseGet(playURLClient(), url, epID, &result.Data); err != nil {
+		var apiErr *APIError
+		// 未购买时返回 -403 或 -10403
+		if errors.As(err, &apiErr) && (apiErr.Code == -403 || apiErr.Code == -10403) {
+			return nil, fmt.Errorf("%w（%s）", ErrNotPurchased, apiErr.Message)
+		}
+		return nil, err
+	}
+	return &result, nil
+}
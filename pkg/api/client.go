@@ -0,0 +1,203 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// ProxyDirect 在代理规则中表示不使用代理
+const ProxyDirect = "direct"
+
+// ProxyRule 按主机名选择代理。Host 匹配主机名本身及其子域名，"*" 匹配所有主机；
+// Proxy 为代理地址（http://、https://、socks5://，可带 user:pass@）或 ProxyDirect
+type ProxyRule struct {
+	Host  string
+	Proxy string
+}
+
+// ProxyConfig 代理配置。为空的字段会依次回退到 Default，再回退到 HTTP_PROXY 等环境变量
+type ProxyConfig struct {
+	Default string      // 所有请求的默认代理
+	API     string      // 视频信息等普通 API 请求
+	PlayURL string      // 仅播放地址查询，可单独走大陆代理解除区域限制
+	Media   string      // CDN 上的音视频流和图片
+	Rules   []ProxyRule // 按主机名匹配，优先于以上各项
+}
+
+// clients 当前使用的客户端，设置对话框修改代理时整体替换，正在进行的请求不受影响
+var clients atomic.Pointer[clientSet]
+
+func init() {
+	clients.Store(&clientSet{
+		api:     &http.Client{Transport: sessionTransport{http.DefaultTransport}},
+		playURL: &http.Client{Transport: sessionTransport{http.DefaultTransport}},
+		media:   &http.Client{},
+	})
+}
+
+func apiClient() *http.Client     { return clients.Load().api }
+func playURLClient() *http.Client { return clients.Load().playURL }
+func mediaClient() *http.Client   { return clients.Load().media }
+
+// HTTPClient 返回普通 API 请求使用的 HTTP 客户端
+func HTTPClient() *http.Client {
+	return apiClient()
+}
+
+// MediaClient 返回下载音视频流和图片使用的 HTTP 客户端
+func MediaClient() *http.Client {
+	return mediaClient()
+}
+
+// Validate 检查所有代理地址和规则是否合法
+func (c ProxyConfig) Validate() error {
+	for _, p := range []string{c.Default, c.API, c.PlayURL, c.Media} {
+		if _, err := parseProxy(p); err != nil {
+			return err
+		}
+	}
+	_, err := parseRules(c.Rules)
+	return err
+}
+
+// SetProxyConfig 按配置重建各类请求使用的 HTTP 客户端
+func SetProxyConfig(cfg ProxyConfig) error {
+	c, err := buildClients(cfg)
+	if err != nil {
+		return err
+	}
+	clients.Store(c)
+	return nil
+}
+
+type clientSet struct {
+	api, playURL, media *http.Client
+}
+
+// buildClients 按配置为三类请求分别创建 HTTP 客户端
+func buildClients(cfg ProxyConfig) (*clientSet, error) {
+	rules, err := parseRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+	// API 和播放地址请求附带登录 Cookie，CDN 请求不需要
+	build := func(category string, withSession bool) (*http.Client, error) {
+		if category == "" {
+			category = cfg.Default
+		}
+		fallback, err := parseProxy(category)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			host := req.URL.Hostname()
+			for _, r := range rules {
+				if r.match(host) {
+					return r.proxy, nil
+				}
+			}
+			if fallback.set {
+				return fallback.url, nil
+			}
+			return http.ProxyFromEnvironment(req)
+		}
+		if withSession {
+			return &http.Client{Transport: sessionTransport{transport}}, nil
+		}
+		return &http.Client{Transport: transport}, nil
+	}
+
+	var c clientSet
+	if c.api, err = build(cfg.API, true); err != nil {
+		return nil, err
+	}
+	if c.playURL, err = build(cfg.PlayURL, true); err != nil {
+		return nil, err
+	}
+	if c.media, err = build(cfg.Media, false); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SetProxy 为所有请求设置同一个代理，为空时遵循环境变量
+func SetProxy(proxy string) error {
+	return SetProxyConfig(ProxyConfig{Default: proxy})
+}
+
+// ParseProxyRules 解析形如 "bilivideo.com=direct; hdslb.com=socks5://127.0.0.1:1080" 的规则列表
+func ParseProxyRules(s string) ([]ProxyRule, error) {
+	var rules []ProxyRule
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' }) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		host, proxy, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("代理规则格式应为 主机=代理: %q", part)
+		}
+		rules = append(rules, ProxyRule{Host: strings.TrimSpace(host), Proxy: strings.TrimSpace(proxy)})
+	}
+	if _, err := parseRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// proxySetting 解析后的代理，set 为 false 表示未配置
+type proxySetting struct {
+	set bool
+	url *url.URL // nil 表示直连
+}
+
+func parseProxy(s string) (proxySetting, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return proxySetting{}, nil
+	case strings.EqualFold(s, ProxyDirect):
+		return proxySetting{set: true}, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return proxySetting{}, fmt.Errorf("无效的代理地址: %q", s)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return proxySetting{}, fmt.Errorf("不支持的代理协议 %q，可用 http、https、socks5", u.Scheme)
+	}
+	return proxySetting{set: true, url: u}, nil
+}
+
+type compiledRule struct {
+	host  string
+	proxy *url.URL
+}
+
+func (r compiledRule) match(host string) bool {
+	return r.host == "*" || host == r.host || strings.HasSuffix(host, "."+r.host)
+}
+
+func parseRules(rules []ProxyRule) ([]compiledRule, error) {
+	var compiled []compiledRule
+	for _, r := range rules {
+		if r.Host == "" {
+			return nil, fmt.Errorf("代理规则缺少主机名")
+		}
+		p, err := parseProxy(r.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		if !p.set {
+			return nil, fmt.Errorf("代理规则 %s 缺少代理地址", r.Host)
+		}
+		compiled = append(compiled, compiledRule{host: strings.ToLower(r.Host), proxy: p.url})
+	}
+	return compiled, nil
+}
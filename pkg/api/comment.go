@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CommentSort 一级评论的排序方式
+type CommentSort int
+
+const (
+	CommentSortTime  CommentSort = 0 // 按发布时间，最新的在前
+	CommentSortLike  CommentSort = 1 // 按点赞数
+	CommentSortReply CommentSort = 2 // 按回复数
+)
+
+// CommentSortNames 配置和命令行中使用的排序名称
+var CommentSortNames = []string{"time", "like", "reply"}
+
+// ParseCommentSort 解析排序名称 time、like 或 reply
+func ParseCommentSort(s string) (CommentSort, error) {
+	for i, name := range CommentSortNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return CommentSort(i), nil
+		}
+	}
+	return 0, fmt.Errorf("未知的评论排序方式 %q，可选 %s", s, strings.Join(CommentSortNames, "、"))
+}
+
+// CommentPageSize 每页评论数，接口允许的最大值
+const CommentPageSize = 20
+
+// ErrCommentsClosed 评论区已关闭
+var ErrCommentsClosed = errors.New("评论区已关闭")
+
+// Comment 一条评论或回复
+type Comment struct {
+	RPID   int64 `json:"rpid"`
+	Root   int64 `json:"root"`   // 所属的一级评论，一级评论为 0
+	Parent int64 `json:"parent"` // 直接回复的评论，一级评论为 0
+	Mid    int64 `json:"mid"`
+	Ctime  int64 `json:"ctime"`
+	Like   int   `json:"like"`
+	Rcount int   `json:"rcount"` // 回复数
+	Member struct {
+		Uname string `json:"uname"`
+	} `json:"member"`
+	Content struct {
+		Message string `json:"message"`
+	} `json:"content"`
+}
+
+// CommentPage 一页评论，Count 为总数
+type CommentPage struct {
+	Count    int
+	Comments []Comment
+}
+
+type commentResponse struct {
+	Page struct {
+		Count int `json:"count"`
+	} `json:"page"`
+	Replies []Comment `json:"replies"`
+	Upper   struct {
+		Top *Comment `json:"top"`
+	} `json:"upper"`
+}
+
+// commentGet 请求评论接口，评论区关闭时返回 ErrCommentsClosed
+func commentGet(url string, aid int64) (*commentResponse, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Referer", fmt.Sprintf("https://www.bilibili.com/video/av%d", aid))
+	var data commentResponse
+	if err := liveDo(apiClient(), req, &data); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == 12002 {
+			return nil, ErrCommentsClosed
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetComments 获取视频的第 pn 页一级评论（从 1 开始），第一页包含 UP 主置顶的评论
+func GetComments(aid int64, sort CommentSort, pn int) (*CommentPage, error) {
+	data, err := commentGet(fmt.Sprintf("https://api.bilibili.com/x/v2/reply?type=1&oid=%d&sort=%d&pn=%d&ps=%d", aid, sort, pn, CommentPageSize), aid)
+	if err != nil {
+		return nil, err
+	}
+	page := &CommentPage{Count: data.Page.Count, Comments: data.Replies}
+	if data.Upper.Top != nil && pn == 1 {
+		page.Comments = append([]Comment{*data.Upper.Top}, page.Comments...)
+	}
+	return page, nil
+}
+
+// GetReplies 获取一级评论 root 下的第 pn 页回复，按时间从早到晚
+func GetReplies(aid, root int64, pn int) (*CommentPage, error) {
+	data, err := commentGet(fmt.Sprintf("https://api.bilibili.com/x/v2/reply/reply?type=1&oid=%d&root=%d&pn=%d&ps=%d", aid, root, pn, CommentPageSize), aid)
+	if err != nil {
+		return nil, err
+	}
+	return &CommentPage{Count: data.Page.Count, Comments: data.Replies}, nil
+}
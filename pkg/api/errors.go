@@ -0,0 +1,26 @@
+package api
+
+import "fmt"
+
+// APIError B 站接口返回的非零业务代码
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("API 返回错误，代码: %d (%s)", e.Code, e.Message)
+	}
+	return fmt.Sprintf("API 返回错误，代码: %d", e.Code)
+}
+
+// Retryable 风控（-412）、请求过于频繁（-509）和服务暂不可用（-503）可重试，
+// 视频已删除（-404）、不可见（62002）等其他代码均视为永久错误
+func (e *APIError) Retryable() bool {
+	switch e.Code {
+	case -412, -509, -503:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// maxInteractiveNodes 遍历剧情图时最多访问的节点数，防止异常数据导致无限请求
+const maxInteractiveNodes = 1000
+
+// InteractiveChoice 问题的一个选项
+type InteractiveChoice struct {
+	ID        int64  `json:"id"` // 选择后跳转到的节点（edge_id）
+	Cid       int    `json:"cid"`
+	Option    string `json:"option"`
+	Condition string `json:"condition,omitempty"`     // 显示条件，依赖隐藏变量
+	Action    string `json:"native_action,omitempty"` // 选择后对隐藏变量的修改
+	IsDefault int    `json:"is_default,omitempty"`    // 倒计时结束时的默认选项
+}
+
+// InteractiveQuestion 节点播放中或播放结束时出现的问题
+type InteractiveQuestion struct {
+	ID         int64               `json:"id"`
+	Type       int                 `json:"type"`
+	StartTime  int                 `json:"start_time_r"` // 距节点结束多少毫秒时出现
+	Duration   int                 `json:"duration"`     // 选择的倒计时（毫秒），-1 表示不限时
+	PauseVideo int                 `json:"pause_video"`
+	Title      string              `json:"title"`
+	Choices    []InteractiveChoice `json:"choices"`
+}
+
+// InteractiveVariable 剧情图中的隐藏变量
+type InteractiveVariable struct {
+	ID     string  `json:"id_v2"`
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	IsShow int     `json:"is_show"`
+}
+
+// InteractiveNode 剧情图的一个节点，对应一个 cid
+type InteractiveNode struct {
+	EdgeID    int64                 `json:"edge_id"`
+	Cid       int                   `json:"cid"`
+	Title     string                `json:"title"`
+	Questions []InteractiveQuestion `json:"questions"`
+}
+
+// InteractiveGraph 互动视频的剧情图
+type InteractiveGraph struct {
+	BVID         string                `json:"bvid"`
+	Title        string                `json:"title"`
+	GraphVersion int64                 `json:"graph_version"`
+	Nodes        []InteractiveNode     `json:"nodes"` // 广度优先顺序，第一个为起始节点
+	Variables    []InteractiveVariable `json:"variables,omitempty"`
+}
+
+// Pages 将节点按顺序转换为从 1 开始编号的分 P，同一个 cid 只保留第一次出现的节点
+func (g *InteractiveGraph) Pages() []Page {
+	var pages []Page
+	seen := map[int]bool{}
+	for _, n := range g.Nodes {
+		if seen[n.Cid] {
+			continue
+		}
+		seen[n.Cid] = true
+		pages = append(pages, Page{Cid: n.Cid, Page: len(pages) + 1, Part: n.Title})
+	}
+	return pages
+}
+
+var graphCache struct {
+	sync.Mutex
+	graphs map[string]*InteractiveGraph
+}
+
+// GetInteractiveGraph 从起始节点出发遍历互动视频的全部节点。
+// 结果按剧情图版本缓存，同一视频的各个节点分别下载时只遍历一次
+func GetInteractiveGraph(bvid string, rootCid int) (*InteractiveGraph, error) {
+	player, err := getPlayerInfo(bvid, rootCid)
+	if err != nil {
+		return nil, err
+	}
+	version := player.Data.Interaction.GraphVersion
+	if version == 0 {
+		return nil, errors.New("不是互动视频或剧情图不可用")
+	}
+	key := fmt.Sprintf("%s@%d", bvid, version)
+	graphCache.Lock()
+	defer graphCache.Unlock()
+	if g, ok := graphCache.graphs[key]; ok {
+		return g, nil
+	}
+
+	g := &InteractiveGraph{BVID: bvid, GraphVersion: version}
+	type pending struct {
+		edgeID int64
+		cid    int
+	}
+	queue := []pending{{0, rootCid}}
+	queued := map[int64]bool{}
+	for len(queue) > 0 && len(g.Nodes) < maxInteractiveNodes {
+		next := queue[0]
+		queue = queue[1:]
+		edge, err := getEdgeInfo(bvid, version, next.edgeID)
+		if err != nil {
+			return nil, fmt.Errorf("获取剧情节点 %d 失败: %w", next.edgeID, err)
+		}
+		// 起始节点的 edge_id 在请求后才知道
+		queued[edge.EdgeID] = true
+		if g.Title == "" {
+			g.Title = edge.Title
+			g.Variables = edge.HiddenVars
+		}
+		node := InteractiveNode{EdgeID: edge.EdgeID, Cid: next.cid, Title: edge.nodeTitle(next.cid), Questions: edge.Edges.Questions}
+		g.Nodes = append(g.Nodes, node)
+		for _, q := range node.Questions {
+			for _, c := range q.Choices {
+				if !queued[c.ID] {
+					queued[c.ID] = true
+					queue = append(queue, pending{c.ID, c.Cid})
+				}
+			}
+		}
+	}
+	if graphCache.graphs == nil {
+		graphCache.graphs = map[string]*InteractiveGraph{}
+	}
+	graphCache.graphs[key] = g
+	return g, nil
+}
+
+// ExpandInteractive 互动视频的分 P 列表只有起始节点，将其替换为剧情图的全部节点；
+// 普通视频不做修改并返回 nil
+func ExpandInteractive(info *VideoInfo) (*InteractiveGraph, error) {
+	if !info.Interactive() {
+		return nil, nil
+	}
+	g, err := GetInteractiveGraph(info.Data.Bvid, info.Data.Cid)
+	if err != nil {
+		return nil, err
+	}
+	info.Data.Pages = g.Pages()
+	return g, nil
+}
+
+type edgeInfo struct {
+	Title     string `json:"title"`
+	EdgeID    int64  `json:"edge_id"`
+	StoryList []struct {
+		EdgeID int64  `json:"edge_id"`
+		Cid    int    `json:"cid"`
+		Title  string `json:"title"`
+	} `json:"story_list"`
+	Edges struct {
+		Questions []InteractiveQuestion `json:"questions"`
+	} `json:"edges"`
+	HiddenVars []InteractiveVariable `json:"hidden_vars"`
+}
+
+// nodeTitle 在剧情列表中查找节点标题，先按 edge_id 再按 cid 匹配
+func (e *edgeInfo) nodeTitle(cid int) string {
+	for _, s := range e.StoryList {
+		if s.EdgeID == e.EdgeID {
+			return s.Title
+		}
+	}
+	for _, s := range e.StoryList {
+		if s.Cid == cid {
+			return s.Title
+		}
+	}
+	return fmt.Sprintf("节点 %d", e.EdgeID)
+}
+
+// getEdgeInfo 获取一个节点的问题和选项，edgeID 为 0 时返回起始节点
+func getEdgeInfo(bvid string, version, edgeID int64) (*edgeInfo, error) {
+	url := fmt.Sprintf("https://api.bilibili.com/x/stein/edgeinfo_v2?bvid=%s&graph_version=%d", bvid, version)
+	if edgeID != 0 {
+		url += fmt.Sprintf("&edge_id=%d", edgeID)
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Referer", VideoURL(bvid))
+	var edge edgeInfo
+	if err := liveDo(apiClient(), req, &edge); err != nil {
+		return nil, err
+	}
+	return &edge, nil
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"dilidili/pkg/retry"
+)
+
+// 直播间状态
+const (
+	LiveOffline = 0 // 未开播
+	LiveOnline  = 1 // 直播中
+	LiveRound   = 2 // 轮播
+)
+
+// LiveRoom 直播间的基本信息
+type LiveRoom struct {
+	RoomID     int64  `json:"room_id"` // 真实房间号
+	ShortID    int64  `json:"short_id"`
+	UID        int64  `json:"uid"`
+	LiveStatus int    `json:"live_status"`
+	LiveTime   int64  `json:"live_time"` // 开播时间（Unix 秒），未开播时为 0
+	Title      string `json:"-"`
+	Uname      string `json:"-"`
+}
+
+// Live 是否正在直播（不含轮播）
+func (r *LiveRoom) Live() bool {
+	return r.LiveStatus == LiveOnline
+}
+
+// LiveStream getRoomPlayInfo 返回的一路可用直播流
+type LiveStream struct {
+	Protocol string   // http_stream 或 http_hls
+	Format   string   // flv、ts 或 fmp4
+	Codec    string   // avc 或 hevc
+	Quality  int      // 当前清晰度代码
+	Accept   []int    // 该流支持的清晰度代码
+	URLs     []string // 同一路流的多个 CDN 地址
+}
+
+// LivePlayInfo 直播间的可用流和清晰度名称
+type LivePlayInfo struct {
+	RoomID     int64
+	LiveStatus int
+	Streams    []LiveStream
+	Qualities  map[int]string // 清晰度代码 -> 名称，如 10000 -> 原画
+}
+
+// liveGet 请求直播 API 并解析 {code, message, data} 结构
+func liveGet(client *http.Client, url string, data any) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	return liveDo(client, req, data)
+}
+
+// liveDo 发送请求并解析 {code, message, data} 结构，未设置 Referer 时使用直播页
+func liveDo(client *http.Client, req *http.Request, data any) error {
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	if req.Header.Get("Referer") == "" {
+		req.Header.Set("Referer", "https://live.bilibili.com/")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := retry.CheckStatus(resp); err != nil {
+		return err
+	}
+	var result struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Msg     string          `json:"msg"` // 音频区接口使用 msg
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if result.Code != 0 {
+		if result.Message == "" {
+			result.Message = result.Msg
+		}
+		return &APIError{Code: result.Code, Message: result.Message}
+	}
+	return json.Unmarshal(result.Data, data)
+}
+
+// GetLiveRoom 将短号或真实房间号解析为真实房间号，并获取开播状态、标题和主播名
+func GetLiveRoom(id int64) (*LiveRoom, error) {
+	var room LiveRoom
+	if err := liveGet(apiClient(), fmt.Sprintf("https://api.live.bilibili.com/room/v1/Room/room_init?id=%d", id), &room); err != nil {
+		return nil, err
+	}
+	var info struct {
+		Title string `json:"title"`
+	}
+	if err := liveGet(apiClient(), fmt.Sprintf("https://api.live.bilibili.com/room/v1/Room/get_info?room_id=%d", room.RoomID), &info); err != nil {
+		return nil, err
+	}
+	room.Title = info.Title
+	var master struct {
+		Info struct {
+			Uname string `json:"uname"`
+		} `json:"info"`
+	}
+	if err := liveGet(apiClient(), fmt.Sprintf("https://api.live.bilibili.com/live_user/v1/Master/info?uid=%d", room.UID), &master); err == nil {
+		room.Uname = master.Info.Uname
+	}
+	return &room, nil
+}
+
+// GetLivePlayInfo 获取直播间的 FLV 和 HLS 流地址，qn 为期望的清晰度代码（10000 为原画）
+func GetLivePlayInfo(roomID int64, qn int) (*LivePlayInfo, error) {
+	url := fmt.Sprintf("https://api.live.bilibili.com/xlive/web-room/v2/index/getRoomPlayInfo"+
+		"?room_id=%d&protocol=0,1&format=0,1,2&codec=0,1&qn=%d&platform=web&ptype=8", roomID, qn)
+	var data struct {
+		RoomID      int64 `json:"room_id"`
+		LiveStatus  int   `json:"live_status"`
+		PlayurlInfo *struct {
+			Playurl struct {
+				GQnDesc []struct {
+					Qn   int    `json:"qn"`
+					Desc string `json:"desc"`
+				} `json:"g_qn_desc"`
+				Stream []struct {
+					ProtocolName string `json:"protocol_name"`
+					Format       []struct {
+						FormatName string `json:"format_name"`
+						Codec      []struct {
+							CodecName string `json:"codec_name"`
+							CurrentQn int    `json:"current_qn"`
+							AcceptQn  []int  `json:"accept_qn"`
+							BaseURL   string `json:"base_url"`
+							URLInfo   []struct {
+								Host  string `json:"host"`
+								Extra string `json:"extra"`
+							} `json:"url_info"`
+						} `json:"codec"`
+					} `json:"format"`
+				} `json:"stream"`
+			} `json:"playurl"`
+		} `json:"playurl_info"`
+	}
+	if err := liveGet(playURLClient(), url, &data); err != nil {
+		return nil, err
+	}
+	info := &LivePlayInfo{RoomID: data.RoomID, LiveStatus: data.LiveStatus, Qualities: map[int]string{}}
+	if data.PlayurlInfo == nil {
+		return info, nil
+	}
+	for _, q := range data.PlayurlInfo.Playurl.GQnDesc {
+		info.Qualities[q.Qn] = q.Desc
+	}
+	for _, s := range data.PlayurlInfo.Playurl.Stream {
+		for _, f := range s.Format {
+			for _, c := range f.Codec {
+				stream := LiveStream{
+					Protocol: s.ProtocolName,
+					Format:   f.FormatName,
+					Codec:    c.CodecName,
+					Quality:  c.CurrentQn,
+					Accept:   c.AcceptQn,
+				}
+				for _, u := range c.URLInfo {
+					stream.URLs = append(stream.URLs, u.Host+c.BaseURL+u.Extra)
+				}
+				info.Streams = append(info.Streams, stream)
+			}
+		}
+	}
+	return info, nil
+}
+
+// DanmuHost 弹幕服务器地址
+type DanmuHost struct {
+	Host    string `json:"host"`
+	WSSPort int    `json:"wss_port"`
+}
+
+// DanmuInfo 连接直播弹幕服务器所需的令牌和地址
+type DanmuInfo struct {
+	Token string      `json:"token"`
+	Hosts []DanmuHost `json:"host_list"`
+	Buvid string      `json:"-"` // 认证包中的 buvid，需与请求时的 Cookie 一致
+}
+
+// GetDanmuInfo 获取直播间弹幕服务器的令牌和地址，roomID 须为真实房间号
+func GetDanmuInfo(roomID int64) (*DanmuInfo, error) {
+	query, err := signWBI(url.Values{"id": {strconv.FormatInt(roomID, 10)}, "type": {"0"}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?"+query, nil)
+	if err != nil {
+		return nil, err
+	}
+	info := &DanmuInfo{Buvid: buvid3()}
+	if info.Buvid != "" {
+		req.AddCookie(&http.Cookie{Name: "buvid3", Value: info.Buvid})
+	}
+	if err := liveDo(apiClient(), req, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"dilidili/pkg/retry"
+)
+
+// ProxyCheck 一类请求的连通性测试结果
+type ProxyCheck struct {
+	Name     string
+	Latency  time.Duration
+	Addr     string // 出口 IP，媒体测试不返回
+	Country  string
+	Province string
+	Err      error
+}
+
+type zoneResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Addr     string `json:"addr"`
+		Country  string `json:"country"`
+		Province string `json:"province"`
+	} `json:"data"`
+}
+
+// TestProxies 使用当前生效的代理配置测试连通性
+func TestProxies() []ProxyCheck {
+	return testClients(clients.Load())
+}
+
+// TestProxyConfig 使用尚未生效的代理配置测试连通性，不影响当前的请求
+func TestProxyConfig(cfg ProxyConfig) ([]ProxyCheck, error) {
+	c, err := buildClients(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return testClients(c), nil
+}
+
+// mediaProbeURL 媒体连通性测试使用的图片，位于 CDN 主机 hdslb.com 上，
+// 与音视频流一样受按主机名的代理规则影响
+const mediaProbeURL = "https://i0.hdslb.com/bfs/face/member/noface.jpg"
+
+// testClients 通过 API 和播放地址两类客户端访问 B 站的 IP 归属地接口，确认代理是否可用以及出口所在地区；
+// 媒体客户端请求 CDN 上的图片，只测试连通性
+func testClients(c *clientSet) []ProxyCheck {
+	return []ProxyCheck{
+		testZone("API", c.api),
+		testZone("播放地址", c.playURL),
+		testMedia("媒体", c.media),
+	}
+}
+
+// testMedia 通过 client 请求 CDN 上的图片
+func testMedia(name string, client *http.Client) ProxyCheck {
+	check := ProxyCheck{Name: name}
+	req, err := http.NewRequest("GET", mediaProbeURL, nil)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	req.Header.Set("Referer", "https://www.bilibili.com/")
+	start := time.Now()
+	client = &http.Client{Transport: client.Transport, Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	defer resp.Body.Close()
+	check.Latency = time.Since(start)
+	if err := retry.CheckStatus(resp); err != nil {
+		check.Err = err
+		return check
+	}
+	_, check.Err = io.Copy(io.Discard, resp.Body)
+	return check
+}
+
+func testZone(name string, client *http.Client) ProxyCheck {
+	check := ProxyCheck{Name: name}
+	start := time.Now()
+	client = &http.Client{Transport: client.Transport, Timeout: 10 * time.Second}
+	resp, err := client.Get("https://api.bilibili.com/x/web-interface/zone")
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	defer resp.Body.Close()
+	check.Latency = time.Since(start)
+	if err := retry.CheckStatus(resp); err != nil {
+		check.Err = err
+		return check
+	}
+	var result zoneResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		check.Err = err
+		return check
+	}
+	if result.Code != 0 {
+		check.Err = &APIError{Code: result.Code, Message: result.Message}
+		return check
+	}
+	check.Addr = result.Data.Addr
+	check.Country = result.Data.Country
+	check.Province = result.Data.Province
+	return check
+}
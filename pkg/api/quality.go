@@ -0,0 +1,75 @@
+package api
+
+// DefaultQuality 默认请求的清晰度（1080P）
+const DefaultQuality = 80
+
+// Quality 清晰度代码（qn）及其名称
+type Quality struct {
+	Code int
+	Name string
+}
+
+// Qualities 支持的清晰度，按从高到低排列
+var Qualities = []Quality{
+	{127, "8K 超高清"},
+	{126, "杜比视界"},
+	{125, "HDR 真彩"},
+	{120, "4K 超清"},
+	{116, "1080P 60帧"},
+	{112, "1080P 高码率"},
+	{80, "1080P 高清"},
+	{74, "720P 60帧"},
+	{64, "720P 高清"},
+	{32, "480P 清晰"},
+	{16, "360P 流畅"},
+}
+
+// QualityName 返回清晰度代码对应的名称，未知代码返回空字符串
+func QualityName(code int) string {
+	for _, q := range Qualities {
+		if q.Code == code {
+			return q.Name
+		}
+	}
+	return ""
+}
+
+// fnval 的标志位，组合后请求对应格式的流
+const (
+	FnvalDash        = 16   // DASH 格式
+	FnvalHDR         = 64   // HDR 视频
+	Fnval4K          = 128  // 4K 视频
+	FnvalDolbyAudio  = 256  // 杜比音频
+	FnvalDolbyVision = 512  // 杜比视界
+	Fnval8K          = 1024 // 8K 视频
+	FnvalAV1         = 2048 // AV1 编码
+
+	// FnvalAll 请求 DASH 及所有可选的视频和音频格式
+	FnvalAll = FnvalDash | FnvalHDR | Fnval4K | FnvalDolbyAudio | FnvalDolbyVision | Fnval8K | FnvalAV1
+)
+
+// 音频流的 id
+const (
+	Audio64K   = 30216
+	Audio132K  = 30232
+	Audio192K  = 30280
+	AudioDolby = 30250 // 杜比全景声
+	AudioHiRes = 30251 // Hi-Res 无损（FLAC）
+)
+
+// AudioQualityName 返回音频流 id 对应的名称，未知 id 返回空字符串
+func AudioQualityName(id int) string {
+	switch id {
+	case Audio64K:
+		return "64K"
+	case Audio132K:
+		return "132K"
+	case Audio192K:
+		return "192K"
+	case AudioDolby:
+		return "杜比全景声"
+	case AudioHiRes:
+		return "Hi-Res 无损"
+	}
+	return ""
+}
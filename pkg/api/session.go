@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// session 登录后的 Cookie，请求 bilibili.com 的接口时附带，用于大会员清晰度和已购买的课程
+var session struct {
+	sync.RWMutex
+	cookies []*http.Cookie
+}
+
+// ParseCookie 解析从浏览器复制的 Cookie，如 "SESSDATA=xxx; bili_jct=yyy"；
+// 只给出一个不含 = 的值时视为 SESSDATA。为空时返回 nil
+func ParseCookie(s string) ([]*http.Cookie, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.Contains(s, "=") {
+		s = "SESSDATA=" + s
+	}
+	var cookies []*http.Cookie
+	hasSession := false
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t\"") {
+			return nil, fmt.Errorf("无效的 Cookie: %q", part)
+		}
+		cookies = append(cookies, &http.Cookie{Name: name, Value: strings.TrimSpace(value)})
+		hasSession = hasSession || name == "SESSDATA"
+	}
+	if !hasSession {
+		return nil, fmt.Errorf("Cookie 中缺少 SESSDATA")
+	}
+	return cookies, nil
+}
+
+// SetCookie 设置登录 Cookie，为空时以未登录状态访问
+func SetCookie(s string) error {
+	cookies, err := ParseCookie(s)
+	if err != nil {
+		return err
+	}
+	session.Lock()
+	session.cookies = cookies
+	session.Unlock()
+	return nil
+}
+
+// LoggedIn 判断是否设置了登录 Cookie
+func LoggedIn() bool {
+	session.RLock()
+	defer session.RUnlock()
+	return len(session.cookies) > 0
+}
+
+// sessionTransport 为发往 bilibili.com 及其子域名的请求附带登录 Cookie
+type sessionTransport struct {
+	base http.RoundTripper
+}
+
+func (t sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if host != "bilibili.com" && !strings.HasSuffix(host, ".bilibili.com") {
+		return t.base.RoundTrip(req)
+	}
+	session.RLock()
+	cookies := session.cookies
+	session.RUnlock()
+	if len(cookies) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	return t.base.RoundTrip(req)
+}
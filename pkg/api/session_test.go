@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseCookie(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []*http.Cookie
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"abc%2C123", []*http.Cookie{{Name: "SESSDATA", Value: "abc%2C123"}}},
+		{"SESSDATA=abc", []*http.Cookie{{Name: "SESSDATA", Value: "abc"}}},
+		{
+			" buvid3=x-y; SESSDATA = abc ;bili_jct=123; ",
+			[]*http.Cookie{{Name: "buvid3", Value: "x-y"}, {Name: "SESSDATA", Value: "abc"}, {Name: "bili_jct", Value: "123"}},
+		},
+		{"SESSDATA=a=b==", []*http.Cookie{{Name: "SESSDATA", Value: "a=b=="}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCookie(tt.input)
+		if err != nil {
+			t.Errorf("ParseCookie(%q) error: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCookie(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{
+		"bili_jct=123",
+		"SESSDATA=abc; novalue",
+		"SESSDATA=abc; =x",
+		`SESSDATA=abc; "quoted"=x`,
+		"SESSDATA=abc; bad name=x",
+	} {
+		if got, err := ParseCookie(input); err == nil {
+			t.Errorf("ParseCookie(%q) = %v, want error", input, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"dilidili/pkg/retry"
+	"dilidili/pkg/utils"
+)
+
+// ResolveShortLink 请求 b23.tv 短链接，返回其跳转到的完整地址
+func ResolveShortLink(input string) (string, error) {
+	link, ok := utils.ShortLink(input)
+	if !ok {
+		return "", fmt.Errorf("不是 b23.tv 短链接: %s", input)
+	}
+	client := *apiClient()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if location == "" {
+		if err := retry.CheckStatus(resp); err != nil {
+			return "", err
+		}
+		return "", errors.New("短链接没有跳转地址")
+	}
+	return location, nil
+}
+
+// ResolveVideoRef 解析 BV 号、av 号、视频链接或 b23.tv 短链接
+func ResolveVideoRef(input string) (utils.VideoRef, error) {
+	if ref, ok := utils.ParseVideoRef(input); ok {
+		return ref, nil
+	}
+	if !utils.IsShortLink(input) {
+		return utils.VideoRef{}, fmt.Errorf("无法识别的BV号或链接: %s", input)
+	}
+	target, err := ResolveShortLink(input)
+	if err != nil {
+		return utils.VideoRef{}, fmt.Errorf("解析短链接失败: %w", err)
+	}
+	ref, ok := utils.ParseVideoRef(target)
+	if !ok {
+		return utils.VideoRef{}, fmt.Errorf("短链接指向的不是视频: %s", target)
+	}
+	return ref, nil
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dilidili/pkg/retry"
+)
+
+// mixinKeyEncTab WBI 签名中由 img_key + sub_key 重排得到混合密钥的下标表
+var mixinKeyEncTab = []int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35, 27, 43, 5, 49,
+	33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13, 37, 48, 7, 16, 24, 55, 40,
+	61, 26, 17, 0, 1, 60, 51, 30, 4, 22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11,
+	36, 20, 34, 44, 52,
+}
+
+// wbiKeyTTL 密钥每天更换，缓存时间短于一天即可
+const wbiKeyTTL = 6 * time.Hour
+
+var wbiCache struct {
+	sync.Mutex
+	key     string
+	fetched time.Time
+}
+
+// wbiMixinKey 获取（并缓存）当前的 WBI 混合密钥
+func wbiMixinKey() (string, error) {
+	wbiCache.Lock()
+	defer wbiCache.Unlock()
+	if wbiCache.key != "" && time.Since(wbiCache.fetched) < wbiKeyTTL {
+		return wbiCache.key, nil
+	}
+	req, err := http.NewRequest("GET", "https://api.bilibili.com/x/web-interface/nav", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	req.Header.Set("Referer", "https://www.bilibili.com/")
+	resp, err := apiClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := retry.CheckStatus(resp); err != nil {
+		return "", err
+	}
+	// 未登录时 code 为 -101，但 wbi_img 照常返回
+	var result struct {
+		Data struct {
+			WbiImg struct {
+				ImgURL string `json:"img_url"`
+				SubURL string `json:"sub_url"`
+			} `json:"wbi_img"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	raw := keyFromURL(result.Data.WbiImg.ImgURL) + keyFromURL(result.Data.WbiImg.SubURL)
+	if len(raw) < len(mixinKeyEncTab) {
+		return "", &APIError{Code: -1, Message: "获取 WBI 密钥失败"}
+	}
+	var b strings.Builder
+	for _, i := range mixinKeyEncTab[:32] {
+		b.WriteByte(raw[i])
+	}
+	wbiCache.key, wbiCache.fetched = b.String(), time.Now()
+	return wbiCache.key, nil
+}
+
+func keyFromURL(u string) string {
+	name := path.Base(u)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// signWBI 为查询参数加上 wts 和 w_rid 签名，返回编码后的查询字符串
+func signWBI(params url.Values) (string, error) {
+	key, err := wbiMixinKey()
+	if err != nil {
+		return "", err
+	}
+	signed := url.Values{}
+	for k, vs := range params {
+		for _, v := range vs {
+			signed.Add(k, strings.Map(func(r rune) rune {
+				if strings.ContainsRune("!'()*", r) {
+					return -1
+				}
+				return r
+			}, v))
+		}
+	}
+	signed.Set("wts", strconv.FormatInt(time.Now().Unix(), 10))
+	// Encode 按键名排序；签名要求空格编码为 %20
+	query := strings.ReplaceAll(signed.Encode(), "+", "%20")
+	sum := md5.Sum([]byte(query + key))
+	return query + "&w_rid=" + hex.EncodeToString(sum[:]), nil
+}
+
+var buvidCache struct {
+	sync.Mutex
+	value string
+}
+
+// buvid3 获取匿名访问使用的 buvid3 设备标识，部分接口缺少该 Cookie 时会返回 -352
+func buvid3() string {
+	buvidCache.Lock()
+	defer buvidCache.Unlock()
+	if buvidCache.value != "" {
+		return buvidCache.value
+	}
+	var data struct {
+		B3 string `json:"b_3"`
+	}
+	if err := liveGet(apiClient(), "https://api.bilibili.com/x/frontend/finger/spi", &data); err == nil {
+		buvidCache.value = data.B3
+	}
+	return buvidCache.value
+}
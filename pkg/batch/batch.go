@@ -0,0 +1,327 @@
+// Package batch 解析批量导入文件并汇总批量任务的结果。
+//
+// 文件每行一个视频，行首或空白后的 # 之后为注释，空行忽略。链接之后可跟以空格分隔的覆盖项：
+//
+//	BV1xx411c7mD
+//	https://www.bilibili.com/video/BV17x411w7KC?p=2   quality=116
+//	av170001 pages=1-3,5 dir=/data/课程 template={part}.{ext}   # 只要前三集和第五集
+//	https://b23.tv/AbC123 pages=all
+//
+// 课堂剧集链接的 pages= 按课程中的集数选择，如 pages=all 下载整个课程。
+// 音频歌单（am）总是展开为其中的单曲，pages= 按歌单中的序号选择。
+package batch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/queue"
+	"dilidili/pkg/utils"
+)
+
+// Item 导入文件中的一行
+type Item struct {
+	Line     int
+	Input    string // 原始链接或编号
+	Pages    []int  // 要下载的分P；为空时使用链接中的 p= 参数
+	AllPages bool   // pages=all，下载全部分P
+	Quality  int    // 为 0 时使用默认清晰度
+	Dir      string // 为空时使用默认输出目录
+	Template string // 为空时使用默认文件名模板
+}
+
+// LineError 某一行的解析错误
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("第 %d 行: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// ParseFile 读取并解析导入文件
+func ParseFile(path string) ([]Item, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse 解析所有行，返回能解析的条目；有行出错时同时返回由各个 *LineError 组成的错误，
+// 调用方可以选择放弃或只导入其余的条目
+func Parse(r io.Reader) ([]Item, error) {
+	var items []Item
+	var errs []error
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(stripComment(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+		item, err := parseLine(fields)
+		if err != nil {
+			errs = append(errs, &LineError{Line: line, Err: err})
+			continue
+		}
+		item.Line = line
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return items, err
+	}
+	return items, errors.Join(errs...)
+}
+
+// stripComment 去掉行首或空白之后的 # 注释，链接中的 # 锚点不受影响
+func stripComment(line string) string {
+	for i, r := range line {
+		if r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseLine(fields []string) (Item, error) {
+	item := Item{Input: fields[0]}
+	if _, ok := utils.ParseVideoRef(item.Input); !ok && !utils.IsShortLink(item.Input) {
+		return item, fmt.Errorf("无法识别的BV号或链接: %s", item.Input)
+	}
+	for _, f := range fields[1:] {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || value == "" {
+			return item, fmt.Errorf("覆盖项格式应为 键=值: %q", f)
+		}
+		switch strings.ToLower(key) {
+		case "quality", "q":
+			qn, err := strconv.Atoi(value)
+			if err != nil || api.QualityName(qn) == "" {
+				return item, fmt.Errorf("不支持的清晰度代码: %s", value)
+			}
+			item.Quality = qn
+		case "pages", "page", "p":
+			if strings.EqualFold(value, "all") {
+				item.AllPages = true
+				continue
+			}
+			pages, err := ParsePages(value)
+			if err != nil {
+				return item, err
+			}
+			item.Pages = pages
+		case "dir", "o":
+			item.Dir = value
+		case "template":
+			if _, err := utils.RenderNameTemplate(value, utils.NameFields{Title: "t", Ext: "mp4"}); err != nil {
+				return item, err
+			}
+			item.Template = value
+		default:
+			return item, fmt.Errorf("未知的覆盖项: %s", key)
+		}
+	}
+	return item, nil
+}
+
+// ParsePages 解析形如 "1-3,5" 的分P范围，结果按出现顺序去重
+func ParsePages(s string) ([]int, error) {
+	var pages []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(from)
+		end := start
+		if err == nil && isRange {
+			end, err = strconv.Atoi(to)
+		}
+		if err != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("无效的分P范围: %q", part)
+		}
+		for p := start; p <= end; p++ {
+			if !seen[p] {
+				seen[p] = true
+				pages = append(pages, p)
+			}
+		}
+	}
+	return pages, nil
+}
+
+// Task 展开后的单个下载任务
+type Task struct {
+	Item    Item
+	Kind    utils.Kind
+	ID      string // 投稿视频为 BV 号，其余为数字编号
+	Options downloader.Options
+}
+
+// Ref 返回任务对应的视频引用
+func (t Task) Ref() utils.VideoRef {
+	return utils.VideoRef{Kind: t.Kind, ID: t.ID, Page: t.Options.Page}
+}
+
+// Expand 解析短链接、展开分P并套用覆盖项，得到要加入队列的任务。
+// pages=all 时需要请求视频信息获取分P数，互动视频的每个剧情节点作为一个分P
+func (it Item) Expand(defaults downloader.Options) ([]Task, error) {
+	ref, err := api.ResolveVideoRef(it.Input)
+	if err != nil {
+		return nil, err
+	}
+	opts := defaults
+	if it.Quality != 0 {
+		opts.Quality = it.Quality
+	}
+	if it.Dir != "" {
+		opts.OutputDir = it.Dir
+	}
+	if it.Template != "" {
+		opts.NameTemplate = it.Template
+	}
+
+	if ref.Kind == utils.KindCheese && (it.AllPages || len(it.Pages) > 0) {
+		return it.expandCheese(ref.NumID(), opts)
+	}
+	if ref.Kind == utils.KindMenu {
+		return it.expandMenu(ref.NumID(), opts)
+	}
+
+	pages := it.Pages
+	switch {
+	case it.AllPages:
+		info, err := api.GetRefInfo(ref)
+		if err != nil {
+			return nil, fmt.Errorf("获取分P列表失败: %w", err)
+		}
+		// 互动视频展开为剧情图的全部节点
+		if _, err := api.ExpandInteractive(info); err != nil {
+			return nil, fmt.Errorf("获取互动视频剧情图失败: %w", err)
+		}
+		pages = nil
+		for _, p := range info.Data.Pages {
+			pages = append(pages, p.Page)
+		}
+	case len(pages) == 0:
+		pages = []int{ref.Page}
+	}
+	tasks := make([]Task, 0, len(pages))
+	for _, p := range pages {
+		o := opts
+		o.Page = p
+		tasks = append(tasks, Task{Item: it, Kind: ref.Kind, ID: ref.ID, Options: o})
+	}
+	return tasks, nil
+}
+
+// expandCheese 按 pages= 选择课程中的剧集，每集一个任务
+func (it Item) expandCheese(epID int64, opts downloader.Options) ([]Task, error) {
+	season, err := api.GetCheeseSeason(epID)
+	if err != nil {
+		return nil, fmt.Errorf("获取课程剧集列表失败: %w", err)
+	}
+	byIndex := map[int]api.CheeseEpisode{}
+	for _, ep := range season.Episodes {
+		byIndex[ep.Index] = ep
+	}
+	var tasks []Task
+	add := func(ep api.CheeseEpisode) {
+		tasks = append(tasks, Task{Item: it, Kind: utils.KindCheese, ID: strconv.FormatInt(ep.ID, 10), Options: opts})
+	}
+	if it.AllPages {
+		for _, ep := range season.Episodes {
+			add(ep)
+		}
+		return tasks, nil
+	}
+	for _, p := range it.Pages {
+		ep, ok := byIndex[p]
+		if !ok {
+			return nil, fmt.Errorf("课程只有 %d 集，没有第 %d 集", len(season.Episodes), p)
+		}
+		add(ep)
+	}
+	return tasks, nil
+}
+
+// expandMenu 将音频歌单展开为单曲，每首一个任务
+func (it Item) expandMenu(menuID int64, opts downloader.Options) ([]Task, error) {
+	_, songs, err := api.GetAudioMenu(menuID)
+	if err != nil {
+		return nil, fmt.Errorf("获取歌单失败: %w", err)
+	}
+	if len(it.Pages) > 0 {
+		selected := make([]api.Song, 0, len(it.Pages))
+		for _, p := range it.Pages {
+			if p < 1 || p > len(songs) {
+				return nil, fmt.Errorf("歌单只有 %d 首，没有第 %d 首", len(songs), p)
+			}
+			selected = append(selected, songs[p-1])
+		}
+		songs = selected
+	}
+	tasks := make([]Task, 0, len(songs))
+	for _, song := range songs {
+		tasks = append(tasks, Task{Item: it, Kind: utils.KindSong, ID: strconv.FormatInt(song.ID, 10), Options: opts})
+	}
+	return tasks, nil
+}
+
+// ExpandAll 展开所有条目，展开失败的条目以 *LineError 返回，不影响其余条目
+func ExpandAll(items []Item, defaults downloader.Options) ([]Task, []error) {
+	var tasks []Task
+	var errs []error
+	for _, it := range items {
+		t, err := it.Expand(defaults)
+		if err != nil {
+			errs = append(errs, &LineError{Line: it.Line, Err: err})
+			continue
+		}
+		tasks = append(tasks, t...)
+	}
+	return tasks, errs
+}
+
+// Summary 汇总一批任务的结果，每个失败的任务单独一行；expandErrs 为未能加入队列的条目，计入失败
+func Summary(jobs []*queue.Job, expandErrs []error) string {
+	counts := map[queue.State]int{}
+	var failures []string
+	for _, err := range expandErrs {
+		failures = append(failures, "  "+err.Error())
+	}
+	for _, job := range jobs {
+		state := job.State()
+		counts[state]++
+		if state == queue.Failed {
+			name := job.Ref().Key()
+			if job.Options.Page > 1 {
+				name += fmt.Sprintf(" P%d", job.Options.Page)
+			}
+			failures = append(failures, fmt.Sprintf("  %s: %v", name, job.Err()))
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "共 %d 个任务：成功 %d，失败 %d", len(jobs)+len(expandErrs), counts[queue.Done], counts[queue.Failed]+len(expandErrs))
+	if n := counts[queue.Canceled]; n > 0 {
+		fmt.Fprintf(&b, "，取消 %d", n)
+	}
+	if n := counts[queue.Paused] + counts[queue.Pending] + counts[queue.Running]; n > 0 {
+		fmt.Fprintf(&b, "，未完成 %d", n)
+	}
+	for _, f := range failures {
+		b.WriteString("\n" + f)
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package batch
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePages(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []int
+	}{
+		{"1", []int{1}},
+		{"1-3,5", []int{1, 2, 3, 5}},
+		{" 2 , 4-5 ", []int{2, 4, 5}},
+		{"3-3", []int{3}},
+		{"5,1-3,2", []int{5, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePages(tt.input)
+		if err != nil {
+			t.Errorf("ParsePages(%q) error: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePages(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"", "0", "-1", "3-1", "a", "1-", "1,,2", "1-2-3"} {
+		if got, err := ParsePages(input); err == nil {
+			t.Errorf("ParsePages(%q) = %v, want error", input, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := `# 导入文件
+BV17x411w7KC
+
+https://www.bilibili.com/video/BV17x411w7KC?p=2#reply   quality=116
+av170001 pages=1-3,5 dir=/data/课程 template={part}.{ext}   # 只要前三集和第五集
+https://b23.tv/AbC123 P=all
+	au590187	# 单曲
+`
+	want := []Item{
+		{Line: 2, Input: "BV17x411w7KC"},
+		{Line: 4, Input: "https://www.bilibili.com/video/BV17x411w7KC?p=2#reply", Quality: 116},
+		{Line: 5, Input: "av170001", Pages: []int{1, 2, 3, 5}, Dir: "/data/课程", Template: "{part}.{ext}"},
+		{Line: 6, Input: "https://b23.tv/AbC123", AllPages: true},
+		{Line: 7, Input: "au590187"},
+	}
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	input := `BV17x411w7KC
+not-a-video
+BV17x411w7KC quality=1
+BV17x411w7KC pages=3-1
+BV17x411w7KC speed=2
+BV17x411w7KC dir=
+BV17x411w7KC template={nope}
+av170001
+`
+	items, err := Parse(strings.NewReader(input))
+	if len(items) != 2 || items[0].Line != 1 || items[1].Line != 8 {
+		t.Errorf("Parse items = %+v, want lines 1 and 8", items)
+	}
+	if err == nil {
+		t.Fatal("Parse error = nil, want line errors")
+	}
+	var lines []int
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var le *LineError
+		if !errors.As(e, &le) {
+			t.Fatalf("error %v is not a *LineError", e)
+		}
+		lines = append(lines, le.Line)
+	}
+	if want := []int{2, 3, 4, 5, 6, 7}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("error lines = %v, want %v", lines, want)
+	}
+}
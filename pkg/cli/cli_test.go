@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dilidili/pkg/config"
+)
+
+// TestSettingsPrecedence 检查设置的优先级：默认值 < 配置文件 < 环境变量 < 命令行参数
+func TestSettingsPrecedence(t *testing.T) {
+	const file = `quality = 64
+output_dir = "/file"
+name_template = "{bvid}.{ext}"
+container = "mkv"
+concurrency = 3
+`
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		check func(s config.Settings) bool
+	}{
+		{"file over default", nil, nil, func(s config.Settings) bool {
+			return s.Quality == 64 && s.OutputDir == "/file" && s.Container == "mkv" && s.Concurrency == 3
+		}},
+		{"env over file", map[string]string{"DILIDILI_QUALITY": "80", "DILIDILI_OUTPUT_DIR": "/env"}, nil, func(s config.Settings) bool {
+			return s.Quality == 80 && s.OutputDir == "/env" && s.NameTemplate == "{bvid}.{ext}"
+		}},
+		{"flag over env", map[string]string{"DILIDILI_QUALITY": "80", "DILIDILI_OUTPUT_DIR": "/env"}, []string{"-quality", "116", "-o", "/flag"}, func(s config.Settings) bool {
+			return s.Quality == 116 && s.OutputDir == "/flag" && s.Container == "mkv"
+		}},
+		// 显式给出的参数即使等于默认值也覆盖配置文件
+		{"flag equal to default still wins", map[string]string{"DILIDILI_CONTAINER": "mkv"}, []string{"-container", "mp4", "-j", "2"}, func(s config.Settings) bool {
+			return s.Container == "mp4" && s.Concurrency == 2 && s.Quality == 64
+		}},
+		{"unset flag keeps env", map[string]string{"DILIDILI_NFO": "true"}, []string{"-quality", "80"}, func(s config.Settings) bool {
+			return s.WriteNFO && s.Quality == 80
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"DILIDILI_QUALITY", "DILIDILI_OUTPUT_DIR", "DILIDILI_CONTAINER", "DILIDILI_NFO", "DILIDILI_CONCURRENCY"} {
+				t.Setenv(key, "")
+				os.Unsetenv(key)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+				t.Fatal(err)
+			}
+			// -write-config 将最终生效的设置写回配置文件
+			args := append([]string{"-config", path}, tt.args...)
+			if code := Run(append(args, "-write-config")); code != 0 {
+				t.Fatalf("Run exit code = %d", code)
+			}
+			s := config.Default()
+			if err := config.LoadFile(path, &s); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(s) {
+				t.Errorf("settings = %+v", s)
+			}
+		})
+	}
+}
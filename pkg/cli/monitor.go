@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"dilidili/pkg/config"
+	"dilidili/pkg/live"
+)
+
+// runMonitor 监视直播间，开播后自动录制，直到收到中断或终止信号
+func runMonitor(args []string) int {
+	fs := flag.NewFlagSet("dilidili monitor", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: dilidili monitor [选项] [房间号或直播间链接...]")
+		fmt.Fprintln(fs.Output(), "未给出房间号时使用配置文件中的 live_rooms")
+		fs.PrintDefaults()
+	}
+	flags := addRecordFlags(fs)
+	interval := fs.Duration("interval", live.DefaultInterval, "检查开播状态的间隔")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	settings, opts, code, err := flags.load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return code
+	}
+	list := settings.LiveRooms
+	if fs.NArg() > 0 {
+		list = strings.Join(fs.Args(), ",")
+	}
+	rooms, err := config.ParseLiveRooms(list)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(rooms) == 0 {
+		fmt.Fprintln(os.Stderr, "没有要监视的直播间，请给出房间号或在配置文件中设置 live_rooms")
+		return 2
+	}
+
+	// 作为服务运行时通常由 SIGTERM 停止，两种信号都会等待录制收尾和转封装
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("开始监视 %d 个直播间，每 %v 检查一次", len(rooms), *interval)
+	live.NewMonitor(rooms, *interval, opts, &monitorHandler{last: map[int64]string{}}).Run(ctx)
+	log.Println("已停止监视")
+	return 0
+}
+
+// monitorHandler 将直播间状态变化以日志形式输出，便于作为后台服务运行；
+// 相同的内容只输出一次，避免每次检查都重复同一条错误
+type monitorHandler struct {
+	mu   sync.Mutex
+	last map[int64]string
+}
+
+func (h *monitorHandler) OnRoomUpdate(s live.RoomStatus) {
+	name := s.Uname
+	if name == "" {
+		name = fmt.Sprint(s.RoomID)
+	}
+	var line string
+	switch {
+	case s.Err != nil:
+		line = s.Err.Error()
+	case s.State == live.RoomRecording && s.Status != "":
+		line = s.Status
+	case s.State == live.RoomRecording:
+		line = "已开播: " + s.Title
+	case s.State == live.RoomOffline:
+		line = "未开播"
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if line == "" || h.last[s.RoomID] == line {
+		return
+	}
+	h.last[s.RoomID] = line
+	log.Printf("[%s] %s", name, line)
+}
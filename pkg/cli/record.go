@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"dilidili/pkg/config"
+	"dilidili/pkg/live"
+	"dilidili/pkg/utils"
+)
+
+// recordFlags record 和 monitor 共用的录制选项
+type recordFlags struct {
+	configPath    *string
+	outputDir     *string
+	quality       *int
+	format        *string
+	nameTemplate  *string
+	splitSize     *string
+	splitDuration *time.Duration
+	noRemux       *bool
+	noDanmaku     *bool
+}
+
+func addRecordFlags(fs *flag.FlagSet) *recordFlags {
+	return &recordFlags{
+		configPath:    fs.String("config", config.DefaultPath(), "配置文件路径"),
+		outputDir:     fs.String("o", "", "输出目录，默认使用配置中的输出目录"),
+		quality:       fs.Int("quality", live.DefaultQuality, "清晰度代码，如 10000 (原画)、400 (蓝光)、250 (超清)"),
+		format:        fs.String("format", live.FormatFLV, "直播流格式: flv 或 hls"),
+		nameTemplate:  fs.String("template", live.DefaultNameTemplate, "文件名模板，{bvid} 为房间号，{page} 为分段序号"),
+		splitSize:     fs.String("split-size", "", "单个分段的最大大小，如 2G"),
+		splitDuration: fs.Duration("split-duration", 0, "单个分段的最长时长，如 1h"),
+		noRemux:       fs.Bool("no-remux", false, "直播结束后不转封装为 MP4"),
+		noDanmaku:     fs.Bool("no-danmaku", false, "不录制弹幕"),
+	}
+}
+
+// load 读取并应用配置文件，返回设置和录制选项；参数错误时 code 为 2
+func (f *recordFlags) load() (config.Settings, live.Options, int, error) {
+	if *f.format != live.FormatFLV && *f.format != live.FormatHLS {
+		return config.Settings{}, live.Options{}, 2, fmt.Errorf("不支持的直播流格式: %s", *f.format)
+	}
+	maxSize, err := live.ParseSize(*f.splitSize)
+	if err != nil {
+		return config.Settings{}, live.Options{}, 2, err
+	}
+	settings, err := loadSettings(*f.configPath)
+	if err != nil {
+		return settings, live.Options{}, 1, err
+	}
+	if err := settings.Apply(); err != nil {
+		return settings, live.Options{}, 1, err
+	}
+	opts := live.Options{
+		Quality:      *f.quality,
+		Format:       *f.format,
+		OutputDir:    *f.outputDir,
+		NameTemplate: *f.nameTemplate,
+		MaxSize:      maxSize,
+		MaxDuration:  *f.splitDuration,
+		Remux:        !*f.noRemux,
+		Danmaku:      !*f.noDanmaku,
+	}
+	if opts.OutputDir == "" {
+		opts.OutputDir = settings.OutputDir
+	}
+	return settings, opts, 0, nil
+}
+
+// runRecord 录制一个直播间，直到直播结束或按下 Ctrl+C
+func runRecord(args []string) int {
+	fs := flag.NewFlagSet("dilidili record", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: dilidili record [选项] <房间号或直播间链接>")
+		fs.PrintDefaults()
+	}
+	flags := addRecordFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	roomID, ok := utils.ParseLiveRoom(fs.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "无法识别的房间号或直播间链接: %s\n", fs.Arg(0))
+		return 2
+	}
+	_, opts, code, err := flags.load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return code
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	files, err := live.Record(ctx, roomID, opts, recordHandler{})
+	if errors.Is(err, live.ErrOffline) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, f := range files {
+		fmt.Println("已保存:", f)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "录制失败: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// recordHandler 将录制状态输出到终端
+type recordHandler struct{}
+
+func (recordHandler) SetStatus(text string) {
+	fmt.Println(text)
+}
+
+func (recordHandler) OnRecordingFile(path string) {}
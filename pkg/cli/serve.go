@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"dilidili/pkg/config"
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/library"
+	"dilidili/pkg/queue"
+	"dilidili/pkg/server"
+)
+
+// runServe 启动本地 HTTP 接口，直到收到 Ctrl+C 或 SIGTERM
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("dilidili serve", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: dilidili serve [选项]")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", config.DefaultPath(), "配置文件路径")
+	addr := fs.String("addr", "127.0.0.1:8787", "监听地址，默认只允许本机访问")
+	token := fs.String("token", os.Getenv("DILIDILI_TOKEN"), "访问令牌，为空时随机生成并打印")
+	origin := fs.String("origin", os.Getenv("DILIDILI_ORIGIN"), "允许跨域访问的来源，如 chrome-extension://<扩展 ID>；为空时拒绝浏览器跨域请求")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	settings, err := loadSettings(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := settings.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "设置无效:\n%v\n", err)
+		return 1
+	}
+	if err := settings.Apply(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			fmt.Fprintf(os.Stderr, "生成令牌失败: %v\n", err)
+			return 1
+		}
+		*token = hex.EncodeToString(buf)
+	}
+
+	lib, err := library.Open(library.DefaultPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开媒体库失败: %v\n", err)
+		return 1
+	}
+	q := queue.New(settings.Concurrency)
+	defer q.Close()
+	q.SetSchedule(settings.ParsedSchedule())
+
+	// Ctrl+C 或 SIGTERM 时停止服务，取消后台的评论导出并等待其结束
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	downloader.SetExportContext(ctx)
+
+	srv := server.New(q, settings.DownloadOptions(), *token, *origin, lib)
+	fmt.Printf("正在监听 http://%s\n令牌: %s\n", *addr, *token)
+	err = srv.ListenAndServe(ctx, *addr)
+	stop()
+	downloader.WaitCommentExports()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
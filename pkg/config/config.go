@@ -0,0 +1,297 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/ratelimit"
+	"dilidili/pkg/schedule"
+	"dilidili/pkg/utils"
+)
+
+// Settings 用户可配置的全部选项。
+// 优先级从低到高：默认值 < 配置文件（或 GUI 偏好设置）< 环境变量 < 命令行参数
+type Settings struct {
+	Quality       int    `toml:"quality"`
+	OutputDir     string `toml:"output_dir"`
+	NameTemplate  string `toml:"name_template"`
+	Concurrency   int    `toml:"concurrency"`   // 同时进行的下载任务数
+	Proxy         string `toml:"proxy"`         // 默认代理，支持 http、https、socks5，可带认证信息
+	APIProxy      string `toml:"api_proxy"`     // 普通 API 请求的代理，"direct" 表示直连
+	PlayURLProxy  string `toml:"playurl_proxy"` // 仅播放地址查询使用的代理
+	MediaProxy    string `toml:"media_proxy"`   // CDN 音视频流和图片的代理
+	ProxyRules    string `toml:"proxy_rules"`   // 按主机名的规则，如 "bilivideo.com=direct"
+	FFmpegPath    string `toml:"ffmpeg_path"`
+	SplitChapters bool   `toml:"split_chapters"`
+	SaveImages    bool   `toml:"save_images"`
+	RateLimit     string `toml:"rate_limit"`       // 全局限速，如 "2M"，为空表示不限速
+	Schedule      string `toml:"schedule"`         // 允许下载的时段，如 "22:00-07:00"，为空表示不限制
+	LiveRooms     string `toml:"live_rooms"`       // 开播后自动录制的直播间，如 "21452505,545068"
+	Cookie        string `toml:"cookie,omitempty"` // 登录后浏览器中的 Cookie（至少包含 SESSDATA），用于已购买的课程等
+	Comments      string `toml:"comments"`         // 导出评论时的排序方式 time、like 或 reply，为空表示不导出
+	WriteNFO      bool   `toml:"nfo"`              // 在输出文件旁生成 Jellyfin/Kodi/Plex 使用的 NFO
+	Container     string `toml:"container"`        // 输出容器 mp4 或 mkv，为空时为 mp4
+}
+
+// MaxConcurrency 允许的最大并发任务数
+const MaxConcurrency = 8
+
+// Default 返回默认设置
+func Default() Settings {
+	return Settings{
+		Quality:      api.DefaultQuality,
+		OutputDir:    DefaultOutputDir(),
+		NameTemplate: utils.DefaultNameTemplate,
+		Concurrency:  2,
+	}
+}
+
+// DefaultOutputDir 默认输出目录：用户下载目录下的 Dilidili 文件夹
+func DefaultOutputDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "Downloads", "Dilidili")
+}
+
+// DefaultPath 返回配置文件的默认位置
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "dilidili.toml"
+	}
+	return filepath.Join(dir, "dilidili", "config.toml")
+}
+
+// Validate 检查设置是否合法
+func (s Settings) Validate() error {
+	var errs []error
+	if api.QualityName(s.Quality) == "" {
+		errs = append(errs, fmt.Errorf("不支持的清晰度代码: %d", s.Quality))
+	}
+	if s.Concurrency < 1 || s.Concurrency > MaxConcurrency {
+		errs = append(errs, fmt.Errorf("并发数需在 1 到 %d 之间: %d", MaxConcurrency, s.Concurrency))
+	}
+	if s.NameTemplate != "" {
+		if _, err := utils.RenderNameTemplate(s.NameTemplate, utils.NameFields{Title: "t", Ext: "mp4"}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg, err := s.ProxyConfig(); err != nil {
+		errs = append(errs, err)
+	} else if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if s.FFmpegPath != "" {
+		if _, err := os.Stat(s.FFmpegPath); err != nil {
+			errs = append(errs, fmt.Errorf("FFmpeg 路径不可用: %w", err))
+		}
+	}
+	if _, err := ratelimit.ParseRate(s.RateLimit); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := schedule.Parse(s.Schedule); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ParseLiveRooms(s.LiveRooms); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := api.ParseCookie(s.Cookie); err != nil {
+		errs = append(errs, err)
+	}
+	if s.Comments != "" {
+		if _, err := api.ParseCommentSort(s.Comments); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch s.Container {
+	case "", downloader.ContainerMP4, downloader.ContainerMKV:
+	default:
+		errs = append(errs, fmt.Errorf("输出容器只能是 mp4 或 mkv: %q", s.Container))
+	}
+	return errors.Join(errs...)
+}
+
+// ProxyConfig 将代理相关设置转换为 api.ProxyConfig
+func (s Settings) ProxyConfig() (api.ProxyConfig, error) {
+	rules, err := api.ParseProxyRules(s.ProxyRules)
+	if err != nil {
+		return api.ProxyConfig{}, err
+	}
+	return api.ProxyConfig{
+		Default: s.Proxy,
+		API:     s.APIProxy,
+		PlayURL: s.PlayURLProxy,
+		Media:   s.MediaProxy,
+		Rules:   rules,
+	}, nil
+}
+
+// Apply 将进程级设置（代理、登录 Cookie、FFmpeg 路径、全局限速）应用到 api 和 downloader
+func (s Settings) Apply() error {
+	cfg, err := s.ProxyConfig()
+	if err != nil {
+		return err
+	}
+	if err := api.SetProxyConfig(cfg); err != nil {
+		return err
+	}
+	if err := api.SetCookie(s.Cookie); err != nil {
+		return err
+	}
+	downloader.SetFFmpegPath(s.FFmpegPath)
+	rate, err := ratelimit.ParseRate(s.RateLimit)
+	if err != nil {
+		return err
+	}
+	ratelimit.Global.SetRate(rate)
+	return nil
+}
+
+// ParsedSchedule 返回解析后的下载时段，设置已通过 Validate 时不会出错
+func (s Settings) ParsedSchedule() schedule.Schedule {
+	sched, _ := schedule.Parse(s.Schedule)
+	return sched
+}
+
+// ParseLiveRooms 解析以逗号或空白分隔的房间号列表，也接受直播间链接
+func ParseLiveRooms(text string) ([]int64, error) {
+	var rooms []int64
+	seen := map[int64]bool{}
+	for _, f := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' || unicode.IsSpace(r) }) {
+		id, ok := utils.ParseLiveRoom(f)
+		if !ok {
+			return nil, fmt.Errorf("无效的直播间: %q", f)
+		}
+		if !seen[id] {
+			seen[id] = true
+			rooms = append(rooms, id)
+		}
+	}
+	return rooms, nil
+}
+
+// ParsedLiveRooms 返回解析后的直播间列表，设置已通过 Validate 时不会出错
+func (s Settings) ParsedLiveRooms() []int64 {
+	rooms, _ := ParseLiveRooms(s.LiveRooms)
+	return rooms
+}
+
+// DownloadOptions 将设置转换为单个任务的下载选项
+func (s Settings) DownloadOptions() downloader.Options {
+	opts := downloader.Options{
+		Quality:       s.Quality,
+		OutputDir:     s.OutputDir,
+		NameTemplate:  s.NameTemplate,
+		SplitChapters: s.SplitChapters,
+		SaveImages:    s.SaveImages,
+		WriteNFO:      s.WriteNFO,
+		Container:     s.Container,
+	}
+	if s.Comments != "" {
+		opts.SaveComments = true
+		opts.CommentSort, _ = api.ParseCommentSort(s.Comments)
+	}
+	return opts
+}
+
+// LoadFile 从 TOML 配置文件读取设置，覆盖 s 中文件里出现的字段；文件不存在时不做修改
+func LoadFile(path string, s *Settings) error {
+	if _, err := toml.DecodeFile(path, s); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("读取配置文件 %s 失败: %w", path, err)
+	}
+	return nil
+}
+
+// SaveFile 将设置写入 TOML 配置文件。代理地址可能带有密码，文件只允许当前用户读写；
+// 登录 Cookie 只在 withCookie 为 true 时写入
+func SaveFile(path string, s Settings, withCookie bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if !withCookie {
+		s.Cookie = ""
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// 已有的文件保留原来的权限，同样收紧
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if err := toml.NewEncoder(f).Encode(s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ApplyEnv 读取 DILIDILI_ 前缀的环境变量覆盖设置
+func ApplyEnv(s *Settings) error {
+	lookup := func(key string) (string, bool) {
+		v, ok := os.LookupEnv("DILIDILI_" + key)
+		return strings.TrimSpace(v), ok
+	}
+	var errs []error
+	setInt := func(key string, dst *int) {
+		if v, ok := lookup(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("环境变量 DILIDILI_%s 不是整数: %q", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	setBool := func(key string, dst *bool) {
+		if v, ok := lookup(key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("环境变量 DILIDILI_%s 不是布尔值: %q", key, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	setString := func(key string, dst *string) {
+		if v, ok := lookup(key); ok {
+			*dst = v
+		}
+	}
+
+	setInt("QUALITY", &s.Quality)
+	setString("OUTPUT_DIR", &s.OutputDir)
+	setString("NAME_TEMPLATE", &s.NameTemplate)
+	setInt("CONCURRENCY", &s.Concurrency)
+	setString("PROXY", &s.Proxy)
+	setString("API_PROXY", &s.APIProxy)
+	setString("PLAYURL_PROXY", &s.PlayURLProxy)
+	setString("MEDIA_PROXY", &s.MediaProxy)
+	setString("PROXY_RULES", &s.ProxyRules)
+	setString("FFMPEG", &s.FFmpegPath)
+	setBool("SPLIT_CHAPTERS", &s.SplitChapters)
+	setBool("SAVE_IMAGES", &s.SaveImages)
+	setString("RATE_LIMIT", &s.RateLimit)
+	setString("SCHEDULE", &s.Schedule)
+	setString("LIVE_ROOMS", &s.LiveRooms)
+	setString("COOKIE", &s.Cookie)
+	setString("COMMENTS", &s.Comments)
+	setBool("NFO", &s.WriteNFO)
+	setString("CONTAINER", &s.Container)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,149 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/retry"
+)
+
+// downloadSong 下载音频区单曲：按账号权限选择最高音质（可能为无损 FLAC），
+// 将歌词和封面写入标签后按文件名模板保存，歌词同时另存为同名 .lrc 文件
+func downloadSong(ctx context.Context, sid int64, info *api.VideoInfo, coverPath string, opts Options, handler ProgressHandler) error {
+	var song *api.Song
+	var stream *api.SongStream
+	err := retry.Default.DoContext(ctx, func() (err error) {
+		if song, err = api.GetSong(sid); err != nil {
+			return err
+		}
+		stream, err = api.GetSongStream(sid, api.SongQualityFLAC)
+		return err
+	}, retryStatus(handler, "获取音频地址"))
+	if err != nil {
+		return fmt.Errorf("获取音频地址失败: %w", err)
+	}
+
+	os.MkdirAll(tmpDir, 0755)
+	bvid := info.Data.Bvid
+	_, rawPath, _ := tempPaths(bvid, 0)
+	ext := songExt(stream)
+
+	// 单曲没有视频流
+	handler.SetVideoProgress(1)
+	handler.SetAudioProgress(0)
+	handler.SetOverallProgress(0)
+	progress := newProgressAdapter(handler)
+	progress.count = 1
+	tracker := newProgressTracker(StreamAudio, progress.report)
+	handler.SetStatus(fmt.Sprintf("正在下载音频（%s）...", stream.QualityDesc()))
+	for _, u := range stream.URLs {
+		err = downloadFileWithProgress(ctx, u, rawPath, opts.Resume, tracker, retryStatus(handler, "音频下载"))
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("音频下载失败: %w", err)
+	}
+
+	// 歌词和封面获取失败不影响下载本身
+	meta := NewMetadata(info, nil)
+	meta.Uploader = song.Artist()
+	if song.Lyric != "" {
+		lrcPath := filepath.Join(tmpDir, bvid+".lrc")
+		if err := downloadFileWithProgress(ctx, song.Lyric, lrcPath, false, nil, nil); err == nil {
+			if data, err := os.ReadFile(lrcPath); err == nil {
+				meta.Lyrics = strings.TrimSpace(string(data))
+			}
+			os.Remove(lrcPath)
+		}
+	}
+	meta.CoverPath = coverPath
+
+	handler.SetOverallProgress(0.8)
+	handler.SetStatus("正在写入标签...")
+	outputPath := filepath.Join(tmpDir, bvid+"_merged"+ext)
+	if err := TagAudio(rawPath, outputPath, meta); err != nil {
+		return fmt.Errorf("写入标签失败: %w", err)
+	}
+	handler.SetStatus("正在校验输出文件...")
+	if err := verifyMedia(outputPath, expectedDuration(info), false); err != nil {
+		return err
+	}
+	os.Remove(rawPath)
+	imagePrefix := bvid
+	if opts.OutputDir != "" {
+		finalPath, err := outputFilePath(opts, info, ext)
+		if err != nil {
+			return err
+		}
+		if err := moveFile(outputPath, finalPath); err != nil {
+			return fmt.Errorf("保存到输出目录失败: %w", err)
+		}
+		outputPath = finalPath
+		imagePrefix = strings.TrimSuffix(filepath.Base(finalPath), ext)
+	}
+	finalFiles := []string{outputPath}
+	if meta.Lyrics != "" {
+		lrcPath := strings.TrimSuffix(outputPath, ext) + ".lrc"
+		if err := os.WriteFile(lrcPath, []byte(meta.Lyrics+"\n"), 0644); err != nil {
+			handler.SetStatus(fmt.Sprintf("保存歌词失败: %v", err))
+		} else {
+			finalFiles = append(finalFiles, lrcPath)
+		}
+	}
+	if opts.SaveImages {
+		handler.SetStatus("正在保存封面...")
+		if _, err := SaveImages(info, coverPath, filepath.Dir(outputPath), imagePrefix); err != nil {
+			handler.SetStatus(fmt.Sprintf("部分图片保存失败: %v", err))
+		}
+	}
+	rh, _ := handler.(ResultHandler)
+	digests, err := outputDigests(finalFiles, opts, rh != nil, handler)
+	if err != nil {
+		return err
+	}
+	if rh != nil {
+		res := newResult(info, digests[0])
+		res.AudioCodec = songCodec(ext)
+		rh.OnDownloadResult(res)
+	}
+	handler.SetOverallProgress(1.0)
+	handler.SetStatus("下载完成")
+	handler.OnDownloadComplete(outputPath, info.Data.Title)
+	return nil
+}
+
+// songExt 根据音质和流地址确定输出文件的扩展名，无法判断时按 M4A 处理
+func songExt(stream *api.SongStream) string {
+	if stream.Type == api.SongQualityFLAC {
+		return ".flac"
+	}
+	if u, err := url.Parse(stream.URLs[0]); err == nil {
+		switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+		case ".m4a", ".mp3", ".flac":
+			return ext
+		}
+	}
+	return ".m4a"
+}
+
+// songCodec 返回扩展名对应的音频编码，用于媒体库记录
+func songCodec(ext string) string {
+	switch ext {
+	case ".flac":
+		return "flac"
+	case ".mp3":
+		return "mp3"
+	}
+	return "aac"
+}
@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/utils"
+)
+
+// Chapter 输出文件中的一个章节
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// ChaptersFromViewPoints 将播放器接口返回的分段章节转换为 Chapter
+func ChaptersFromViewPoints(points []api.ViewPoint) []Chapter {
+	var chapters []Chapter
+	for _, p := range points {
+		if p.To <= p.From {
+			continue
+		}
+		chapters = append(chapters, Chapter{
+			Title: strings.TrimSpace(p.Content),
+			Start: time.Duration(p.From) * time.Second,
+			End:   time.Duration(p.To) * time.Second,
+		})
+	}
+	return chapters
+}
+
+// writeFFMetadata 以 ffmetadata 格式写出章节，供 ffmpeg -map_chapters 使用
+func writeFFMetadata(path string, chapters []Chapter) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, ";FFMETADATA1")
+	for _, c := range chapters {
+		fmt.Fprintln(w, "[CHAPTER]")
+		fmt.Fprintln(w, "TIMEBASE=1/1000")
+		fmt.Fprintf(w, "START=%d\n", c.Start.Milliseconds())
+		fmt.Fprintf(w, "END=%d\n", c.End.Milliseconds())
+		fmt.Fprintf(w, "title=%s\n", escapeFFMetadata(c.Title))
+	}
+	return w.Flush()
+}
+
+// escapeFFMetadata 转义 ffmetadata 中的特殊字符
+func escapeFFMetadata(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		"=", `\=`,
+		";", `\;`,
+		"#", `\#`,
+		"\n", "\\\n",
+	)
+	return replacer.Replace(s)
+}
+
+// SplitByChapters 按章节将 inputPath 无损切分为多个文件，返回生成的文件路径
+func SplitByChapters(inputPath string, chapters []Chapter) ([]string, error) {
+	ffmpegPath, err := findFFmpegPath()
+	if err != nil {
+		return nil, fmt.Errorf("找不到FFmpeg: %w", err)
+	}
+
+	ext := filepath.Ext(inputPath)
+	dir := filepath.Dir(inputPath)
+	base := strings.TrimSuffix(filepath.Base(inputPath), ext)
+	var outputs []string
+	for i, c := range chapters {
+		name := fmt.Sprintf("%s - %02d", base, i+1)
+		if c.Title != "" {
+			name += " " + c.Title
+		}
+		out := filepath.Join(dir, utils.SanitizeFileName(name+ext))
+		cmd := exec.Command(ffmpegPath,
+			"-ss", formatSeconds(c.Start),
+			"-to", formatSeconds(c.End),
+			"-i", inputPath,
+			"-map", "0",
+			"-c", "copy",
+			"-map_chapters", "-1",
+			"-metadata", "title="+c.Title,
+			"-y",
+			out,
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return outputs, fmt.Errorf("切分第 %d 章失败: %w", i+1, err)
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
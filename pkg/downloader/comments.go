@@ -0,0 +1,225 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"sync"
+	"time"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/retry"
+)
+
+// commentInterval 相邻两次评论请求的最小间隔。评论多的视频需要上千次请求，过快会触发风控
+const commentInterval = 500 * time.Millisecond
+
+// commentRecord 评论导出文件中的一行
+type commentRecord struct {
+	RPID    int64  `json:"rpid"`
+	Root    int64  `json:"root"`   // 所属的一级评论，一级评论为 0
+	Parent  int64  `json:"parent"` // 直接回复的评论，一级评论为 0
+	Mid     int64  `json:"mid"`
+	Uname   string `json:"uname"`
+	Message string `json:"message"`
+	Ctime   int64  `json:"ctime"`
+	Like    int    `json:"like"`
+	Replies int    `json:"replies"`
+}
+
+func newCommentRecord(c api.Comment) commentRecord {
+	return commentRecord{
+		RPID:    c.RPID,
+		Root:    c.Root,
+		Parent:  c.Parent,
+		Mid:     c.Mid,
+		Uname:   c.Member.Uname,
+		Message: c.Content.Message,
+		Ctime:   c.Ctime,
+		Like:    c.Like,
+		Replies: c.Rcount,
+	}
+}
+
+// commentThread 一级评论及其全部回复
+type commentThread struct {
+	commentRecord
+	ReplyList []commentRecord
+}
+
+// commentFetcher 按 commentInterval 节流并在风控时退避重试的评论请求
+type commentFetcher struct {
+	ctx    context.Context
+	notify retry.NotifyFunc
+	last   time.Time
+}
+
+func (f *commentFetcher) fetch(get func() (*api.CommentPage, error)) (*api.CommentPage, error) {
+	if wait := commentInterval - time.Since(f.last); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-f.ctx.Done():
+			return nil, f.ctx.Err()
+		}
+	}
+	var page *api.CommentPage
+	err := retry.Default.DoContext(f.ctx, func() (err error) {
+		page, err = get()
+		return err
+	}, f.notify)
+	f.last = time.Now()
+	return page, err
+}
+
+var (
+	// commentExports 正在后台运行的评论导出
+	commentExports sync.WaitGroup
+	exportMu       sync.Mutex
+	exportCtx      = context.Background()
+)
+
+// SetExportContext 设置后台评论导出所在的应用级上下文。界面和服务退出时取消它，
+// 再调用 WaitCommentExports 等待导出结束
+func SetExportContext(ctx context.Context) {
+	exportMu.Lock()
+	exportCtx = ctx
+	exportMu.Unlock()
+}
+
+// exportComments 在后台导出评论并通过 handler 报告结果。评论多的视频需要数小时，
+// 不占用下载任务的队列名额，也不随任务的取消而中断，只在应用退出时取消
+func exportComments(aid int64, sort api.CommentSort, base string, handler ProgressHandler) {
+	exportMu.Lock()
+	ctx := exportCtx
+	exportMu.Unlock()
+	commentExports.Add(1)
+	go func() {
+		defer commentExports.Done()
+		files, err := SaveComments(ctx, aid, sort, base, handler)
+		if err != nil {
+			handler.SetStatus(fmt.Sprintf("导出评论失败: %v", err))
+			return
+		}
+		handler.SetStatus("评论已导出: " + files[0])
+	}()
+}
+
+// WaitCommentExports 等待后台的评论导出全部结束，命令行、界面和服务在退出前调用
+func WaitCommentExports() {
+	commentExports.Wait()
+}
+
+// SaveComments 分页获取视频的全部一级评论和回复，逐条写入 base.comments.jsonl
+// （一级评论后紧跟它的回复），再生成便于阅读的 base.comments.html，返回写入的文件。
+// 评论区已关闭时返回 api.ErrCommentsClosed
+func SaveComments(ctx context.Context, aid int64, sort api.CommentSort, base string, handler ProgressHandler) (files []string, err error) {
+	f := &commentFetcher{ctx: ctx, notify: retryStatus(handler, "获取评论")}
+	jsonlPath := base + ".comments.jsonl"
+	file, err := os.Create(jsonlPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// 中途失败时不留下不完整的导出
+	defer func() {
+		if err != nil {
+			os.Remove(jsonlPath)
+		}
+	}()
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+
+	var threads []commentThread
+	seen := map[int64]bool{}
+	total := 0
+	for pn := 1; ; pn++ {
+		page, err := f.fetch(func() (*api.CommentPage, error) { return api.GetComments(aid, sort, pn) })
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, c := range page.Comments {
+			// 置顶评论可能在后面的页中再次出现
+			if seen[c.RPID] {
+				continue
+			}
+			seen[c.RPID] = true
+			added++
+			thread := commentThread{commentRecord: newCommentRecord(c)}
+			if err := enc.Encode(thread.commentRecord); err != nil {
+				return nil, err
+			}
+			for rpn := 1; len(thread.ReplyList) < c.Rcount; rpn++ {
+				replies, err := f.fetch(func() (*api.CommentPage, error) { return api.GetReplies(aid, c.RPID, rpn) })
+				if err != nil {
+					return nil, err
+				}
+				if len(replies.Comments) == 0 {
+					break
+				}
+				for _, r := range replies.Comments {
+					rec := newCommentRecord(r)
+					if err := enc.Encode(rec); err != nil {
+						return nil, err
+					}
+					thread.ReplyList = append(thread.ReplyList, rec)
+				}
+			}
+			total += 1 + len(thread.ReplyList)
+			threads = append(threads, thread)
+		}
+		handler.SetStatus(fmt.Sprintf("正在获取评论（第 %d 页，已获取 %d 条）...", pn, total))
+		if len(page.Comments) == 0 || added == 0 || len(threads) >= page.Count {
+			break
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	htmlPath := base + ".comments.html"
+	out, err := os.Create(htmlPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := commentPage.Execute(out, threads); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return []string{jsonlPath, htmlPath}, out.Close()
+}
+
+var commentPage = template.Must(template.New("comments").Funcs(template.FuncMap{
+	"time": func(ts int64) string { return time.Unix(ts, 0).Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>评论（{{len .}} 条一级评论）</title>
+<style>
+body { max-width: 860px; margin: 0 auto; padding: 16px; font-family: sans-serif; color: #222; }
+.comment { padding: 10px 0; border-bottom: 1px solid #eee; }
+.reply { margin-left: 32px; padding: 6px 0; border-top: 1px dashed #eee; }
+.meta { color: #999; font-size: 13px; }
+.user { color: #fb7299; font-weight: bold; margin-right: 8px; }
+.message { white-space: pre-wrap; margin: 4px 0; }
+</style>
+</head>
+<body>
+{{range .}}<div class="comment">
+<div><span class="user">{{.Uname}}</span><span class="meta">{{time .Ctime}} · 赞 {{.Like}}{{if .Replies}} · 回复 {{.Replies}}{{end}}</span></div>
+<div class="message">{{.Message}}</div>
+{{range .ReplyList}}<div class="reply">
+<div><span class="user">{{.Uname}}</span><span class="meta">{{time .Ctime}} · 赞 {{.Like}}</span></div>
+<div class="message">{{.Message}}</div>
+</div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
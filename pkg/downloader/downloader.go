@@ -1,14 +1,20 @@
 package downloader
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"dilidili/pkg/api"
+	"dilidili/pkg/ratelimit"
+	"dilidili/pkg/retry"
+	"dilidili/pkg/utils"
 )
 
 // ProgressHandler 界面进度回调接口，在 GUI 中实现
@@ -20,111 +26,704 @@ type ProgressHandler interface {
 	OnDownloadComplete(outputPath, title string)
 }
 
+// Options 下载选项
+type Options struct {
+	SplitChapters bool            // 按章节将输出额外切分为多个文件
+	SaveImages    bool            // 在输出文件旁保存封面、UP 主头像和分 P 首帧原图
+	SaveComments  bool            // 在输出目录中的视频旁导出评论，多 P 视频的评论属于整个视频，只随第一个分 P 导出
+	CommentSort   api.CommentSort // 导出评论时一级评论的排序方式
+	WriteNFO      bool            // 在输出文件旁生成供 Jellyfin、Kodi、Plex 读取的 NFO
+	Quality       int             // 期望的清晰度代码，为 0 时使用 api.DefaultQuality
+	Page          int             // 要下载的分P（从 1 开始），为 0 时下载第一个分P
+	Container     string          // 输出容器 ContainerMP4 或 ContainerMKV，为空时为 MP4
+
+	// OutputDir 非空时合并结果直接移动到该目录，文件名由 NameTemplate 决定；
+	// 为空时保留在临时目录，由调用方自行保存
+	OutputDir    string
+	NameTemplate string // 为空时使用 utils.DefaultNameTemplate
+
+	// Resume 从临时目录中已有的部分文件续传，用于暂停后继续
+	Resume bool
+}
+
+// 输出容器
+const (
+	ContainerMP4 = "mp4"
+	ContainerMKV = "mkv" // 任何 FFmpeg 都能封装 FLAC 音频和杜比视界
+)
+
+// InfoHandler 可选接口，ProgressHandler 同时实现时在获取到视频信息后回调，
+// 用于在下载开始前展示封面等信息
+type InfoHandler interface {
+	OnVideoInfo(info *api.VideoInfo)
+}
+
+// CoverHandler 可选接口，封面下载到临时文件后回调其路径，用于界面预览。
+// 文件在下载结束后删除，需要的话应在回调中读取
+type CoverHandler interface {
+	OnCover(path string)
+}
+
+// ResultHandler 可选接口，ProgressHandler 同时实现时在 OnDownloadComplete 之前
+// 回调最终文件的详细信息，用于写入媒体库等
+type ResultHandler interface {
+	OnDownloadResult(res *Result)
+}
+
 // DownloadAndMerge 执行下载并合并逻辑，同步调用或在 goroutine 中调用
 func DownloadAndMerge(bvid string, handler ProgressHandler) error {
+	return DownloadAndMergeWithOptions(bvid, Options{}, handler)
+}
+
+// DownloadAndMergeWithOptions 按指定选项执行下载并合并
+func DownloadAndMergeWithOptions(bvid string, opts Options, handler ProgressHandler) error {
+	return DownloadAndMergeContext(context.Background(), bvid, opts, handler)
+}
+
+// DownloadAndMergeContext 与 DownloadAndMergeWithOptions 相同，ctx 取消时中止下载并返回 ctx.Err()；
+// 已下载的部分保留在临时目录中，之后可用 Options.Resume 续传
+func DownloadAndMergeContext(ctx context.Context, bvid string, opts Options, handler ProgressHandler) error {
+	return DownloadContext(ctx, utils.KindVideo, bvid, opts, handler)
+}
+
+// DownloadContext 与 DownloadAndMergeContext 相同，kind 和 id 指定投稿视频、课堂剧集或单曲
+func DownloadContext(ctx context.Context, kind utils.Kind, id string, opts Options, handler ProgressHandler) error {
+	ref := utils.VideoRef{Kind: kind, ID: id}
+	key := ref.Key()
 	handler.SetStatus("正在获取视频信息...")
-	videoInfo, err := api.GetVideoInfo(bvid)
+	var videoInfo *api.VideoInfo
+	err := retry.Default.DoContext(ctx, func() (err error) {
+		videoInfo, err = api.GetRefInfo(ref)
+		return err
+	}, retryStatus(handler, "获取视频信息"))
 	if err != nil {
 		return fmt.Errorf("获取视频信息失败: %w", err)
 	}
+	// 互动视频的各个节点按剧情图的顺序作为分 P
+	var graph *api.InteractiveGraph
+	err = retry.Default.DoContext(ctx, func() (err error) {
+		graph, err = api.ExpandInteractive(videoInfo)
+		return err
+	}, retryStatus(handler, "获取剧情图"))
+	if err != nil {
+		return fmt.Errorf("获取互动视频剧情图失败: %w", err)
+	}
+	if err := selectPage(videoInfo, opts.Page); err != nil {
+		return err
+	}
 	title := videoInfo.Data.Title
 	handler.SetStatus(fmt.Sprintf("获取到视频: %s", title))
-
-	playURL, err := api.GetPlayURL(bvid, videoInfo.Data.Cid)
+	if graph != nil {
+		handler.SetStatus(fmt.Sprintf("互动视频，共 %d 个节点", len(videoInfo.Data.Pages)))
+	}
+	if ih, ok := handler.(InfoHandler); ok {
+		ih.OnVideoInfo(videoInfo)
+	}
+	// 封面只下载一次，依次用于预览、写入元数据和 SaveImages
+	coverPath := fetchCover(ctx, videoInfo, key, opts.Page, handler)
+	if coverPath != "" {
+		defer os.Remove(coverPath)
+	}
+	if kind == utils.KindSong {
+		return downloadSong(ctx, ref.NumID(), videoInfo, coverPath, opts, handler)
+	}
+	var outputPath string
+	if graph != nil && opts.Page == 0 {
+		outputPath, err = downloadNodes(ctx, ref, videoInfo, coverPath, opts, handler)
+	} else {
+		outputPath, err = downloadPage(ctx, ref, videoInfo, coverPath, opts, handler)
+	}
 	if err != nil {
-		return fmt.Errorf("获取播放地址失败: %w", err)
+		return err
 	}
-	if len(playURL.Data.Dash.Video) == 0 || len(playURL.Data.Dash.Audio) == 0 {
-		return fmt.Errorf("未找到视频或音频流")
+	if graph != nil && opts.OutputDir != "" {
+		if path, err := exportGraph(graph, videoInfo, opts, filepath.Ext(outputPath)); err != nil {
+			handler.SetStatus(fmt.Sprintf("导出剧情图失败: %v", err))
+		} else {
+			handler.SetStatus("剧情图已导出: " + path)
+		}
 	}
-	videoURL := playURL.Data.Dash.Video[0].BaseURL
-	audioURL := playURL.Data.Dash.Audio[0].BaseURL
+	return nil
+}
 
-	tmpDir := "temp"
-	os.MkdirAll(tmpDir, 0755)
+// downloadNodes 未指定分 P 时依次下载互动视频的全部节点，复用已获取的视频信息，
+// 返回最后一个节点的输出路径
+func downloadNodes(ctx context.Context, ref utils.VideoRef, info *api.VideoInfo, coverPath string, opts Options, handler ProgressHandler) (string, error) {
+	var outputPath string
+	for i, p := range info.Data.Pages {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		handler.SetStatus(fmt.Sprintf("节点 %d/%d: %s", i+1, len(info.Data.Pages), p.Part))
+		// 各节点只替换 Cid，Pages 与原信息共享，以便记录各节点的时长
+		node := *info
+		o := opts
+		o.Page = p.Page
+		if err := selectPage(&node, p.Page); err != nil {
+			return "", err
+		}
+		path, err := downloadPage(ctx, ref, &node, coverPath, o, handler)
+		if err != nil {
+			return "", fmt.Errorf("节点 %d（%s）: %w", p.Page, p.Part, err)
+		}
+		outputPath = path
+	}
+	return outputPath, nil
+}
 
-	videoPath := filepath.Join(tmpDir, bvid+"_video.m4s")
-	audioPath := filepath.Join(tmpDir, bvid+"_audio.m4s")
-	outputPath := filepath.Join(tmpDir, bvid+"_merged.mp4")
+// downloadPage 下载并合并 videoInfo 当前 Cid 对应的分 P，返回输出文件路径
+func downloadPage(ctx context.Context, ref utils.VideoRef, videoInfo *api.VideoInfo, coverPath string, opts Options, handler ProgressHandler) (string, error) {
+	id, key := ref.ID, ref.Key()
+	qn := opts.Quality
+	if qn == 0 {
+		qn = api.DefaultQuality
+	}
+	cheese := ref.Kind == utils.KindCheese
+	var playURL *api.PlayURLResponse
+	err := retry.Default.DoContext(ctx, func() (err error) {
+		if cheese {
+			playURL, err = api.GetCheesePlayURL(ref.NumID(), videoInfo.Data.Aid, videoInfo.Data.Cid, qn)
+		} else {
+			playURL, err = api.GetPlayURL(id, videoInfo.Data.Cid, qn)
+		}
+		return err
+	}, retryStatus(handler, "获取播放地址"))
+	if err != nil {
+		return "", fmt.Errorf("获取播放地址失败: %w", err)
+	}
+	fillPageDuration(videoInfo, playURL.Data.Timelength)
+	// 部分旧视频没有 DASH 流，只返回音视频合在一起的 FLV/MP4 分段（durl）
+	legacy := len(playURL.Data.Dash.Video) == 0 && len(playURL.Data.Durl) > 0
+	audioStreams := playURL.AudioStreams()
+	if !legacy && (len(playURL.Data.Dash.Video) == 0 || len(audioStreams) == 0) {
+		return "", fmt.Errorf("未找到视频或音频流")
+	}
 
-	// 并行下载
-	var wg sync.WaitGroup
-	wg.Add(2)
+	os.MkdirAll(tmpDir, 0755)
+	videoPath, audioPath, outputPath := tempPaths(key, opts.Page)
+	if opts.Container == ContainerMKV {
+		outputPath = mkvPath(outputPath)
+	}
 
 	handler.SetVideoProgress(0)
 	handler.SetAudioProgress(0)
 	handler.SetOverallProgress(0)
+	progress := newProgressAdapter(handler)
 
+	var videoStream, audioStream api.DashStream
+	var segments []string
+	if legacy {
+		progress.count = 1
+		opts.Quality = playURL.Data.Quality
+		handler.SetStatus(fmt.Sprintf("该视频只提供 %s 分段，共 %d 段", playURL.Data.Format, len(playURL.Data.Durl)))
+		segments, err = downloadDurl(ctx, key, opts, playURL, progress.report, handler)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			return "", fmt.Errorf("视频下载失败: %w", err)
+		}
+		// 分段中已包含音频
+		handler.SetAudioProgress(1)
+	} else {
+		videoStream = playURL.Data.Dash.Video[selectVideoStream(playURL, qn)]
+		audioStream = audioStreams[selectAudioStream(audioStreams)]
+		opts.Quality = videoStream.ID
+		if name := api.AudioQualityName(audioStream.ID); name != "" {
+			handler.SetStatus(fmt.Sprintf("%s · 音频 %s", api.QualityName(videoStream.ID), name))
+		}
+		if err := downloadDash(ctx, videoStream.BaseURL, audioStream.BaseURL, videoPath, audioPath, opts.Resume, progress, handler); err != nil {
+			return "", err
+		}
+	}
+
+	// 元数据和封面获取失败不影响下载本身；课堂剧集没有标签和章节
+	var tags []string
+	var points []api.ViewPoint
+	if !cheese {
+		tags, _ = api.GetVideoTags(id)
+		points, _ = api.GetViewPoints(id, videoInfo.Data.Cid)
+	}
+	meta := NewMetadata(videoInfo, tags)
+	meta.Chapters = ChaptersFromViewPoints(points)
+	meta.CoverPath = coverPath
+
+	handler.SetOverallProgress(0.8)
+	if legacy {
+		handler.SetStatus("正在拼接分段...")
+		err = ConcatFilesWithMetadata(segments, outputPath, meta)
+	} else {
+		handler.SetStatus("正在合并音视频...")
+		err = MergeFilesWithMetadata(videoPath, audioPath, outputPath, meta)
+		// 较旧或精简的 FFmpeg 不支持在 MP4 中封装 FLAC，改为 MKV
+		if err != nil && isMP4(outputPath) && audioStream.ID == api.AudioHiRes {
+			handler.SetStatus("FFmpeg 无法将无损音频封装为 MP4，改为输出 MKV...")
+			os.Remove(outputPath)
+			outputPath = mkvPath(outputPath)
+			err = MergeFilesWithMetadata(videoPath, audioPath, outputPath, meta)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("合并失败: %w", err)
+	}
+	handler.SetStatus("正在校验输出文件...")
+	if err := verifyOutput(outputPath, expectedDuration(videoInfo)); err != nil {
+		return "", err
+	}
+	os.Remove(videoPath)
+	os.Remove(audioPath)
+	for _, seg := range segments {
+		os.Remove(seg)
+	}
+	imagePrefix := key
+	if opts.OutputDir != "" {
+		finalPath, err := outputFilePath(opts, videoInfo, filepath.Ext(outputPath))
+		if err != nil {
+			return "", err
+		}
+		if err := moveFile(outputPath, finalPath); err != nil {
+			return "", fmt.Errorf("保存到输出目录失败: %w", err)
+		}
+		outputPath = finalPath
+		imagePrefix = strings.TrimSuffix(filepath.Base(finalPath), filepath.Ext(finalPath))
+	}
+	finalFiles := []string{outputPath}
+	if opts.SaveImages {
+		handler.SetStatus("正在保存封面和头像...")
+		if _, err := SaveImages(videoInfo, coverPath, filepath.Dir(outputPath), imagePrefix); err != nil {
+			handler.SetStatus(fmt.Sprintf("部分图片保存失败: %v", err))
+		}
+	}
+	if opts.OutputDir != "" {
+		base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+		if _, err := WriteInfoJSON(videoInfo, tags, base); err != nil {
+			handler.SetStatus(fmt.Sprintf("写入视频信息失败: %v", err))
+		}
+		if opts.WriteNFO {
+			if _, err := WriteNFO(videoInfo, tags, base); err != nil {
+				handler.SetStatus(fmt.Sprintf("写入 NFO 失败: %v", err))
+			}
+		}
+	}
+	if opts.SaveComments && !cheese && opts.Page <= 1 && opts.OutputDir != "" {
+		base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+		exportComments(videoInfo.Data.Aid, opts.CommentSort, base, handler)
+	}
+	if opts.SplitChapters && len(meta.Chapters) > 0 {
+		handler.SetStatus(fmt.Sprintf("正在按章节切分（共 %d 章）...", len(meta.Chapters)))
+		parts, err := SplitByChapters(outputPath, meta.Chapters)
+		if err != nil {
+			return "", fmt.Errorf("章节切分失败: %w", err)
+		}
+		handler.SetStatus(fmt.Sprintf("已切分为 %d 个文件，位于 %s", len(parts), filepath.Dir(outputPath)))
+		finalFiles = append(finalFiles, parts...)
+	}
+	rh, _ := handler.(ResultHandler)
+	digests, err := outputDigests(finalFiles, opts, rh != nil, handler)
+	if err != nil {
+		return "", err
+	}
+	if rh != nil {
+		res := newResult(videoInfo, digests[0])
+		res.Quality = opts.Quality
+		res.VideoCodec = videoStream.Codecs
+		res.AudioCodec = audioStream.Codecs
+		rh.OnDownloadResult(res)
+	}
+	handler.SetOverallProgress(1.0)
+	handler.SetStatus("下载完成")
+	handler.OnDownloadComplete(outputPath, videoInfo.Data.Title)
+	return outputPath, nil
+}
+
+// downloadDash 并行下载 DASH 的视频流和音频流
+func downloadDash(ctx context.Context, videoURL, audioURL, videoPath, audioPath string, resume bool, progress *progressAdapter, handler ProgressHandler) error {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var videoErr, audioErr error
 	go func() {
 		defer wg.Done()
 		handler.SetStatus("正在下载视频流...")
-		if err := downloadFileWithProgress(videoURL, videoPath, handler.SetVideoProgress); err != nil {
+		videoErr = downloadStream(ctx, videoURL, videoPath, resume, newProgressTracker(StreamVideo, progress.report), handler, "视频流")
+		if videoErr != nil {
 			handler.SetStatus("视频下载失败")
 		}
 	}()
 	go func() {
 		defer wg.Done()
 		handler.SetStatus("正在下载音频流...")
-		if err := downloadFileWithProgress(audioURL, audioPath, handler.SetAudioProgress); err != nil {
+		audioErr = downloadStream(ctx, audioURL, audioPath, resume, newProgressTracker(StreamAudio, progress.report), handler, "音频流")
+		if audioErr != nil {
 			handler.SetStatus("音频下载失败")
 		}
 	}()
 	wg.Wait()
-
-	handler.SetStatus("正在合并音视频...")
-	handler.SetOverallProgress(0.8)
-	if err := MergeFiles(videoPath, audioPath, outputPath); err != nil {
-		return fmt.Errorf("合并失败: %w", err)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if videoErr != nil {
+		return fmt.Errorf("视频下载失败: %w", videoErr)
+	}
+	if audioErr != nil {
+		return fmt.Errorf("音频下载失败: %w", audioErr)
 	}
-	handler.SetOverallProgress(1.0)
-	handler.SetStatus("下载完成")
-	handler.OnDownloadComplete(outputPath, title)
 	return nil
 }
 
-// downloadFileWithProgress 下载文件并周期性调用 progressCb
-func downloadFileWithProgress(url, filename string, progressCb func(float64)) error {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+// downloadDurl 依次下载旧式 durl 分段，主地址失败时尝试备用地址。
+// 进度按所有分段的总大小统计
+func downloadDurl(ctx context.Context, bvid string, opts Options, playURL *api.PlayURLResponse, report func(Progress), handler ProgressHandler) ([]string, error) {
+	durl := playURL.Data.Durl
+	ext := ".flv"
+	if strings.HasPrefix(playURL.Data.Format, "mp4") {
+		ext = ".mp4"
+	}
+	var total int64
+	for _, seg := range durl {
+		total += seg.Size
+	}
+	var paths []string
+	var before int64
+	for i, seg := range durl {
+		path := durlSegmentPath(bvid, opts.Page, i, ext)
+		// 每个分段单独计数，换算为全部分段的进度后再报告
+		segTracker := newProgressTracker(StreamVideo, func(p Progress) {
+			p.Done += before
+			if total > 0 {
+				p.Total = total
+				if p.AvgSpeed > 0 {
+					p.ETA = time.Duration(float64(total-p.Done) / p.AvgSpeed * float64(time.Second))
+				}
+			}
+			if p.Phase == PhaseFinished && i < len(durl)-1 {
+				p.Phase = PhaseDownloading
+			}
+			report(p)
+		})
+		handler.SetStatus(fmt.Sprintf("正在下载第 %d/%d 段...", i+1, len(durl)))
+		var err error
+		for _, url := range append([]string{seg.URL}, seg.BackupURL...) {
+			err = downloadFileWithProgress(ctx, url, path, opts.Resume, segTracker, retryStatus(handler, fmt.Sprintf("第 %d 段下载", i+1)))
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil {
+			before += fi.Size()
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// downloadStream 下载一路 DASH 流并校验 fMP4 结构，结构损坏时删除后重新下载一次
+func downloadStream(ctx context.Context, url, path string, resume bool, tracker *progressTracker, handler ProgressHandler, name string) error {
+	onRetry := retryStatus(handler, name+"下载")
+	if err := downloadFileWithProgress(ctx, url, path, resume, tracker, onRetry); err != nil {
+		return err
+	}
+	err := verifyFMP4(path)
+	if err == nil {
+		return nil
+	}
+	handler.SetStatus(fmt.Sprintf("%s校验失败，重新下载: %v", name, err))
+	os.Remove(path)
+	if err := downloadFileWithProgress(ctx, url, path, false, tracker, onRetry); err != nil {
+		return err
+	}
+	return verifyFMP4(path)
+}
+
+// expectedDuration 返回当前分 P 在 API 中的时长，用于校验合并结果。
+// 分 P 列表中有当前分 P 但不知道时长时返回 0 跳过检查，不与整个视频的时长比较
+func expectedDuration(info *api.VideoInfo) time.Duration {
+	for _, p := range info.Data.Pages {
+		if p.Cid == info.Data.Cid {
+			return time.Duration(p.Duration) * time.Second
+		}
+	}
+	return time.Duration(info.Data.Duration) * time.Second
+}
+
+// fillPageDuration 互动视频节点的分 P 没有时长，用播放地址返回的时长（毫秒）补上
+func fillPageDuration(info *api.VideoInfo, timelength int) {
+	if timelength <= 0 {
+		return
+	}
+	for i, p := range info.Data.Pages {
+		if p.Cid == info.Data.Cid && p.Duration == 0 {
+			info.Data.Pages[i].Duration = (timelength + 500) / 1000
+		}
+	}
+}
+
+// retryStatus 返回在重试前通过 SetStatus 报告进度的回调
+func retryStatus(handler ProgressHandler, what string) retry.NotifyFunc {
+	return func(attempt int, err error, delay time.Duration) {
+		handler.SetStatus(fmt.Sprintf("%s出错: %v，%.0f 秒后第 %d 次重试", what, err, delay.Seconds(), attempt))
+	}
+}
+
+// selectVideoStream 选择不超过期望清晰度的最高视频流，都高于期望时选最低的一个
+func selectVideoStream(playURL *api.PlayURLResponse, qn int) int {
+	best, lowest := -1, 0
+	for i, v := range playURL.Data.Dash.Video {
+		if v.ID <= qn && (best < 0 || v.ID > playURL.Data.Dash.Video[best].ID) {
+			best = i
+		}
+		if v.ID < playURL.Data.Dash.Video[lowest].ID {
+			lowest = i
+		}
+	}
+	if best < 0 {
+		return lowest
+	}
+	return best
+}
+
+// selectAudioStream 选择音质最好的音频流：Hi-Res 无损优先，其次杜比全景声，其余按码率
+func selectAudioStream(streams []api.DashStream) int {
+	rank := func(s api.DashStream) int {
+		switch s.ID {
+		case api.AudioHiRes:
+			return 2
+		case api.AudioDolby:
+			return 1
+		}
+		return 0
+	}
+	best := 0
+	for i, s := range streams {
+		b := streams[best]
+		if r, rb := rank(s), rank(b); r > rb || r == rb && (s.Bandwidth > b.Bandwidth || s.Bandwidth == b.Bandwidth && s.ID > b.ID) {
+			best = i
+		}
+	}
+	return best
+}
+
+// outputFilePath 按文件名模板计算输出文件的完整路径，ext 带前导点。
+// 多 P 视频的模板不区分分 P 时自动加上分 P 序号和标题
+func outputFilePath(opts Options, info *api.VideoInfo, ext string) (string, error) {
+	tpl := opts.NameTemplate
+	if tpl == "" {
+		tpl = utils.DefaultNameTemplate
+	}
+	if len(info.Data.Pages) > 1 {
+		tpl = utils.PagedNameTemplate(tpl)
+	}
+	fields := utils.NameFields{
+		Title:    info.Data.Title,
+		Uploader: info.Data.Owner.Name,
+		BVID:     info.Data.Bvid,
+		Page:     1,
+		Cid:      info.Data.Cid,
+		Quality:  api.QualityName(opts.Quality),
+		Ext:      strings.TrimPrefix(ext, "."),
+	}
+	if info.Data.Pubdate > 0 {
+		fields.Date = time.Unix(info.Data.Pubdate, 0)
+	}
+	for _, p := range info.Data.Pages {
+		if p.Cid == info.Data.Cid {
+			fields.Page = p.Page
+			fields.Part = p.Part
+		}
+	}
+	rel, err := utils.RenderNameTemplate(tpl, fields)
+	if err != nil {
+		return "", fmt.Errorf("文件名模板错误: %w", err)
+	}
+	return filepath.Join(opts.OutputDir, rel), nil
+}
+
+// moveFile 移动文件并按需创建目标目录，跨分区时退化为复制后删除
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile 复制文件内容到 dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// tmpDir 下载过程中的临时文件目录
+const tmpDir = "temp"
+
+// tempPaths 返回视频的临时音视频流和合并结果路径，不同分P互不冲突
+func tempPaths(bvid string, page int) (video, audio, merged string) {
+	key := bvid
+	if page > 1 {
+		key = fmt.Sprintf("%s_p%d", bvid, page)
+	}
+	return filepath.Join(tmpDir, key+"_video.m4s"),
+		filepath.Join(tmpDir, key+"_audio.m4s"),
+		filepath.Join(tmpDir, key+"_merged.mp4")
+}
+
+// mkvPath 将临时输出文件的扩展名改为 .mkv
+func mkvPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".mkv"
+}
+
+// selectPage 将 info.Data.Cid 切换为指定分P，后续的播放地址、章节、结果记录都以此为准
+func selectPage(info *api.VideoInfo, page int) error {
+	if page <= 1 {
+		return nil
+	}
+	for _, p := range info.Data.Pages {
+		if p.Page == page {
+			info.Data.Cid = p.Cid
+			return nil
+		}
+	}
+	return fmt.Errorf("视频只有 %d 个分P，没有第 %d P", len(info.Data.Pages), page)
+}
+
+// durlSegmentPath 返回旧式分段的临时文件路径
+func durlSegmentPath(bvid string, page, index int, ext string) string {
+	return fmt.Sprintf("%s%02d%s", durlPrefix(bvid, page), index+1, ext)
+}
+
+func durlPrefix(bvid string, page int) string {
+	video, _, _ := tempPaths(bvid, page)
+	return strings.TrimSuffix(video, "_video.m4s") + "_durl_"
+}
+
+// RemovePartial 删除取消的任务留下的临时文件，key 为 utils.VideoRef.Key()
+func RemovePartial(bvid string, page int) {
+	video, audio, merged := tempPaths(bvid, page)
+	for _, p := range []string{video, audio, merged, mkvPath(merged)} {
+		os.Remove(p)
+	}
+	segments, _ := filepath.Glob(durlPrefix(bvid, page) + "*")
+	for _, p := range segments {
+		os.Remove(p)
+	}
+}
+
+// downloadFileWithProgress 下载文件并通过 tracker 报告进度（tracker 可为 nil）。
+// 遇到可重试的错误时按 retry.Default 退避重试，并通过 Range 请求从已下载的位置续传；
+// resume 为 true 时第一次请求也从已有文件的末尾续传
+func downloadFileWithProgress(ctx context.Context, url, filename string, resume bool, tracker *progressTracker, onRetry retry.NotifyFunc) error {
+	if tracker == nil {
+		tracker = newProgressTracker(StreamVideo, nil)
+	}
+	err := retry.Default.DoContext(ctx, func() error {
+		var offset int64
+		if resume {
+			if fi, err := os.Stat(filename); err == nil {
+				offset = fi.Size()
+			}
+		}
+		resume = true
+		tracker.setPhase(PhaseConnecting)
+		return downloadRange(ctx, url, filename, offset, tracker)
+	}, func(attempt int, err error, delay time.Duration) {
+		tracker.setPhase(PhaseRetrying)
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+	})
+	if err == nil {
+		tracker.setPhase(PhaseFinished)
+	}
+	return err
+}
+
+// downloadRange 从 offset 处开始下载，offset 为 0 时覆盖已有文件
+func downloadRange(ctx context.Context, url, filename string, offset int64, tracker *progressTracker) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
 	req.Header.Set("Referer", "https://www.bilibili.com/")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
-	resp, err := client.Do(req)
+	resp, err := api.MediaClient().Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	out, err := os.Create(filename)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// 上次已经下载完整，只是在收尾阶段出错
+		tracker.start(offset, offset)
+		return nil
+	default:
+		// 服务器不支持续传时从头开始
+		offset = 0
+		if err := retry.CheckStatus(resp); err != nil {
+			return err
+		}
+	}
+
+	out, err := os.OpenFile(filename, flags, 0644)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
 	totalSize := resp.ContentLength
-	var downloaded int64
+	if totalSize > 0 {
+		totalSize += offset
+	}
+	tracker.start(offset, totalSize)
+	downloaded := offset
 	buf := make([]byte, 32*1024)
 	for {
 		n, err := resp.Body.Read(buf)
 		if n > 0 {
+			if err := ratelimit.Global.WaitN(ctx, n); err != nil {
+				return err
+			}
 			if _, werr := out.Write(buf[:n]); werr != nil {
 				return werr
 			}
+			tracker.add(n)
 			downloaded += int64(n)
-			if totalSize > 0 {
-				progressCb(float64(downloaded) / float64(totalSize))
-			}
 		}
 		if err != nil {
 			if err == io.EOF {
-				progressCb(1.0)
 				break
 			}
 			return err
 		}
 	}
+	if totalSize > 0 && downloaded != totalSize {
+		return errIncomplete(downloaded, totalSize)
+	}
 	return nil
 }
@@ -0,0 +1,64 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+
+	"dilidili/pkg/api"
+)
+
+func TestExpectedDuration(t *testing.T) {
+	info := func(cid, duration int, pages ...api.Page) *api.VideoInfo {
+		v := &api.VideoInfo{}
+		v.Data.Cid = cid
+		v.Data.Duration = duration
+		v.Data.Pages = pages
+		return v
+	}
+	tests := []struct {
+		name string
+		info *api.VideoInfo
+		want time.Duration
+	}{
+		{"single page", info(1, 90, api.Page{Cid: 1, Page: 1, Duration: 90}), 90 * time.Second},
+		{"second page", info(2, 300, api.Page{Cid: 1, Page: 1, Duration: 100}, api.Page{Cid: 2, Page: 2, Duration: 200}), 200 * time.Second},
+		// 互动视频节点没有时长时跳过检查，而不是与整个视频比较
+		{"node without duration", info(5, 600, api.Page{Cid: 1, Page: 1, Duration: 30}, api.Page{Cid: 5, Page: 2}), 0},
+		{"no pages", info(1, 90), 90 * time.Second},
+		{"cid not in pages", info(9, 90, api.Page{Cid: 1, Page: 1, Duration: 30}), 90 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := expectedDuration(tt.info); got != tt.want {
+			t.Errorf("%s: expectedDuration = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFillPageDuration(t *testing.T) {
+	tests := []struct {
+		name       string
+		duration   int
+		timelength int
+		want       int
+	}{
+		{"rounded to seconds", 0, 12_499, 12},
+		{"rounded up", 0, 12_500, 13},
+		{"known duration kept", 20, 12_500, 20},
+		{"no timelength", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		v := &api.VideoInfo{}
+		v.Data.Cid = 2
+		v.Data.Pages = []api.Page{{Cid: 1, Page: 1}, {Cid: 2, Page: 2, Duration: tt.duration}}
+		fillPageDuration(v, tt.timelength)
+		if got := v.Data.Pages[1].Duration; got != tt.want {
+			t.Errorf("%s: duration = %d, want %d", tt.name, got, tt.want)
+		}
+		if v.Data.Pages[0].Duration != 0 {
+			t.Errorf("%s: other page duration changed to %d", tt.name, v.Data.Pages[0].Duration)
+		}
+		if got := expectedDuration(v); got != time.Duration(tt.want)*time.Second {
+			t.Errorf("%s: expectedDuration = %s, want %ds", tt.name, got, tt.want)
+		}
+	}
+}
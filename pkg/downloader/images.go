@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"dilidili/pkg/api"
+)
+
+// SaveImages 将封面、UP 主头像以及多 P 视频每个分 P 的首帧以原图分辨率保存到 dir，
+// 文件名以 prefix 开头；cover 不为空时复制这个已下载的封面文件。
+// 单张图片失败不会中断其余图片，错误会合并返回
+func SaveImages(info *api.VideoInfo, cover, dir, prefix string) ([]string, error) {
+	type image struct{ url, name string }
+	images := []image{
+		{info.Data.Pic, prefix + "_cover"},
+		{info.Data.Owner.Face, prefix + "_avatar"},
+	}
+	if len(info.Data.Pages) > 1 {
+		for _, p := range info.Data.Pages {
+			images = append(images, image{p.FirstFrame, fmt.Sprintf("%s_p%02d_frame", prefix, p.Page)})
+		}
+	}
+
+	var saved []string
+	var errs []error
+	for _, img := range images {
+		if img.url == "" {
+			continue
+		}
+		url := api.OriginalImageURL(img.url)
+		target := filepath.Join(dir, img.name+imageExt(url))
+		var err error
+		if img.url == info.Data.Pic && cover != "" {
+			err = copyFile(cover, target)
+		} else {
+			err = downloadFileWithProgress(context.Background(), url, target, false, nil, nil)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", img.name, err))
+			continue
+		}
+		saved = append(saved, target)
+	}
+	return saved, errors.Join(errs...)
+}
+
+// fetchCover 将封面原图下载到临时目录并通知 CoverHandler，失败时返回空字符串。
+// 文件名按分P区分，并且不同于 SaveImages 在临时目录中保存的封面
+func fetchCover(ctx context.Context, info *api.VideoInfo, key string, page int, handler ProgressHandler) string {
+	if info.Data.Pic == "" {
+		return ""
+	}
+	os.MkdirAll(tmpDir, 0755)
+	video, _, _ := tempPaths(key, page)
+	path := strings.TrimSuffix(video, "_video.m4s") + "_cover.tmp" + imageExt(info.Data.Pic)
+	if err := downloadFileWithProgress(ctx, api.OriginalImageURL(info.Data.Pic), path, false, nil, nil); err != nil {
+		return ""
+	}
+	if ch, ok := handler.(CoverHandler); ok {
+		ch.OnCover(path)
+	}
+	return path
+}
+
+// imageExt 从图片地址中取出扩展名，无法识别时按 jpg 处理
+func imageExt(url string) string {
+	if i := strings.IndexAny(url, "?#@"); i >= 0 {
+		url = url[:i]
+	}
+	ext := strings.ToLower(path.Ext(url))
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".webp", ".gif":
+		return ext
+	}
+	return ".jpg"
+}
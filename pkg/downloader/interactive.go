@@ -0,0 +1,176 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dilidili/pkg/api"
+)
+
+// graphNode 导出的剧情节点，File 为节点视频相对于剧情图文件的路径
+type graphNode struct {
+	api.InteractiveNode
+	File string `json:"file"`
+}
+
+// exportedGraph 写入 .graph.json 并嵌入 .graph.html 的剧情图
+type exportedGraph struct {
+	BVID      string                    `json:"bvid"`
+	Title     string                    `json:"title"`
+	Nodes     []graphNode               `json:"nodes"`
+	Variables []api.InteractiveVariable `json:"variables,omitempty"`
+}
+
+// exportGraph 将剧情图导出到起始节点视频旁的 .graph.json 和 .graph.html，
+// 后者可在浏览器中离线按选项跳转播放已下载的节点。每个节点下载完成后都会重写，返回 HTML 的路径
+func exportGraph(g *api.InteractiveGraph, info *api.VideoInfo, opts Options, ext string) (string, error) {
+	nodePath := func(cid int) (string, error) {
+		clone := *info
+		clone.Data.Cid = cid
+		return outputFilePath(opts, &clone, ext)
+	}
+	root, err := nodePath(g.Nodes[0].Cid)
+	if err != nil {
+		return "", err
+	}
+	base := strings.TrimSuffix(root, ext)
+	dir := filepath.Dir(base)
+
+	out := exportedGraph{BVID: g.BVID, Title: info.Data.Title, Variables: g.Variables}
+	owner := map[string]int{}
+	for _, n := range g.Nodes {
+		path, err := nodePath(n.Cid)
+		if err != nil {
+			return "", err
+		}
+		// 文件名模板不区分分 P 时各节点会写入同一个文件，剧情图无法使用
+		if cid, ok := owner[path]; ok && cid != n.Cid {
+			return "", fmt.Errorf("多个节点的文件名相同（%s），请在文件名模板中使用 {page}、{part} 或 {cid}", filepath.Base(path))
+		}
+		owner[path] = n.Cid
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return "", err
+		}
+		out.Nodes = append(out.Nodes, graphNode{InteractiveNode: n, File: filepath.ToSlash(rel)})
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".graph.json", data, 0644); err != nil {
+		return "", err
+	}
+	htmlPath := base + ".graph.html"
+	f, err := os.Create(htmlPath)
+	if err != nil {
+		return "", err
+	}
+	if err := graphPlayer.Execute(f, out); err != nil {
+		f.Close()
+		return "", err
+	}
+	return htmlPath, f.Close()
+}
+
+// graphPlayer 离线播放页：节点播放结束后显示问题和选项，点击选项跳转到对应节点。
+// 隐藏变量和选项的显示条件不做计算，全部选项都会显示
+var graphPlayer = template.Must(template.New("graph").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; background: #111; color: #eee; font-family: sans-serif; }
+main { max-width: 960px; margin: 0 auto; padding: 16px; }
+video { width: 100%; background: #000; }
+#question { margin: 12px 0; font-size: 18px; }
+#choices button { margin: 4px 8px 4px 0; padding: 8px 16px; font-size: 16px; cursor: pointer; }
+#history { color: #999; font-size: 14px; }
+#history a { color: #6cf; cursor: pointer; }
+</style>
+</head>
+<body>
+<main>
+<h2>{{.Title}}</h2>
+<h3 id="node"></h3>
+<video id="player" controls autoplay></video>
+<div id="question"></div>
+<div id="choices"></div>
+<p id="history"></p>
+</main>
+<script>
+const graph = {{.}};
+const nodes = new Map(graph.nodes.map(n => [n.edge_id, n]));
+const player = document.getElementById("player");
+const question = document.getElementById("question");
+const choices = document.getElementById("choices");
+const visited = [];
+
+function src(file) {
+	return file.split("/").map(encodeURIComponent).join("/");
+}
+
+function play(id) {
+	const node = nodes.get(id);
+	if (!node) {
+		question.textContent = "剧情图中没有节点 " + id;
+		return;
+	}
+	visited.push(node);
+	document.getElementById("node").textContent = node.title;
+	question.textContent = "";
+	choices.replaceChildren();
+	player.src = src(node.file);
+	player.play().catch(() => {});
+	renderHistory();
+}
+
+function showChoices() {
+	const node = visited[visited.length - 1];
+	const questions = (node.questions || []).filter(q => q.choices && q.choices.length);
+	if (!questions.length) {
+		question.textContent = "结局";
+		return;
+	}
+	question.textContent = questions.map(q => q.title).filter(t => t).join(" / ");
+	for (const q of questions) {
+		for (const c of q.choices) {
+			const button = document.createElement("button");
+			button.textContent = c.option || ("节点 " + c.id);
+			button.onclick = () => play(c.id);
+			choices.appendChild(button);
+		}
+	}
+}
+
+function renderHistory() {
+	const el = document.getElementById("history");
+	el.replaceChildren("路径：");
+	visited.forEach((node, i) => {
+		if (i > 0) el.append(" → ");
+		const a = document.createElement("a");
+		a.textContent = node.title;
+		a.onclick = () => { visited.length = i; play(node.edge_id); };
+		el.appendChild(a);
+	});
+}
+
+player.addEventListener("ended", showChoices);
+player.addEventListener("error", () => {
+	question.textContent = "无法播放 " + visited[visited.length - 1].file + "，该节点可能还没有下载";
+	showChoices();
+});
+play(graph.nodes[0].edge_id);
+</script>
+</body>
+</html>
+`))
@@ -6,35 +6,184 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 )
 
 // MergeFiles 合并 video.m4s 和 audio.m4s 为 mp4
 func MergeFiles(videoPath, audioPath, outputPath string) error {
+	return MergeFilesWithMetadata(videoPath, audioPath, outputPath, nil)
+}
+
+// MergeFilesWithMetadata 合并音视频并写入元数据。meta.CoverPath 非空时嵌入封面
+// （MP4 写为 covr 封面，MKV 写为附件），meta.Chapters 非空时写入章节
+func MergeFilesWithMetadata(videoPath, audioPath, outputPath string, meta *Metadata) error {
+	return mergeWithMetadata([]string{"-i", videoPath, "-i", audioPath}, []string{"-map", "0:v", "-map", "1:a"}, 2, outputPath, meta)
+}
+
+// ConcatFilesWithMetadata 用 concat 分离器无损拼接旧式 durl 分段（FLV 或 MP4，音视频已合在一起），
+// 并像 MergeFilesWithMetadata 一样写入元数据、封面和章节
+func ConcatFilesWithMetadata(segments []string, outputPath string, meta *Metadata) error {
+	listFile := outputPath + ".concat"
+	var list strings.Builder
+	for _, seg := range segments {
+		abs, err := filepath.Abs(seg)
+		if err != nil {
+			return err
+		}
+		// concat 列表中的路径用单引号包围，单引号本身写为 '\''
+		list.WriteString("file '" + strings.ReplaceAll(abs, "'", `'\''`) + "'\n")
+	}
+	if err := os.WriteFile(listFile, []byte(list.String()), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(listFile)
+	args := []string{"-f", "concat", "-safe", "0", "-i", listFile}
+	return mergeWithMetadata(args, []string{"-map", "0:v", "-map", "0:a?"}, 1, outputPath, meta)
+}
+
+// mergeWithMetadata 在已有的输入参数 args 和流映射 maps 之后追加章节、封面和元数据并执行 ffmpeg，
+// inputs 为 args 中的输入个数
+func mergeWithMetadata(args, maps []string, inputs int, outputPath string, meta *Metadata) error {
 	ffmpegPath, err := findFFmpegPath()
 	if err != nil {
 		return fmt.Errorf("找不到FFmpeg: %w", err)
 	}
+	args, err = mergeArgs(args, maps, inputs, outputPath, meta)
+	defer os.Remove(chapterFilePath(outputPath))
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(ffmpegPath, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// chapterFilePath 返回合并时临时写入章节的 FFMETADATA 文件路径
+func chapterFilePath(outputPath string) string {
+	return outputPath + ".ffmeta"
+}
+
+// mergeArgs 生成 mergeWithMetadata 的完整 ffmpeg 参数。有章节时写入 chapterFilePath，由调用方删除。
+// 封面在 MKV 中写为附件，在 MP4 中写为 attached_pic 视频流
+func mergeArgs(args, maps []string, inputs int, outputPath string, meta *Metadata) ([]string, error) {
+	var extra []string
+	if meta != nil && len(meta.Chapters) > 0 {
+		chapterFile := chapterFilePath(outputPath)
+		if err := writeFFMetadata(chapterFile, meta.Chapters); err != nil {
+			return nil, fmt.Errorf("写入章节失败: %w", err)
+		}
+		args = append(args, "-i", chapterFile)
+		extra = append(extra, "-map_chapters", strconv.Itoa(inputs))
+		inputs++
+	}
+
+	cover := ""
+	if meta != nil && meta.CoverPath != "" {
+		if _, err := os.Stat(meta.CoverPath); err == nil {
+			cover = meta.CoverPath
+		}
+	}
+	switch {
+	case cover != "" && isMKV(outputPath):
+		extra = append(extra,
+			"-attach", cover,
+			"-metadata:s:t", "mimetype="+coverMimeType(cover),
+			"-metadata:s:t", "filename=cover"+filepath.Ext(cover),
+		)
+	case cover != "":
+		args = append(args, "-i", cover)
+		maps = append(maps, "-map", strconv.Itoa(inputs))
+		extra = append(extra, "-disposition:v:1", "attached_pic")
+		inputs++
+	}
 
-	cmd := exec.Command(ffmpegPath,
-		"-i", videoPath,
-		"-i", audioPath,
-		"-c", "copy",
+	args = append(args, maps...)
+	args = append(args, "-c", "copy")
+	args = append(args, extra...)
+	if isMP4(outputPath) {
+		// 允许在 MP4 中封装 FLAC 音频，并保留杜比视界的配置信息
+		args = append(args, "-strict", "experimental")
+	}
+	args = append(args, meta.ffmpegArgs(outputPath)...)
+	args = append(args,
 		"-y", // 覆盖输出文件
 		outputPath,
 	)
+	return args, nil
+}
 
+// TagAudio 不重新编码地为音频文件写入元数据、歌词和封面，标签格式由输出容器决定：
+// FLAC 为 Vorbis 注释，MP3 为 ID3v2，M4A 为 iTunes 标签
+func TagAudio(inputPath, outputPath string, meta *Metadata) error {
+	ffmpegPath, err := findFFmpegPath()
+	if err != nil {
+		return fmt.Errorf("找不到FFmpeg: %w", err)
+	}
+	args := []string{"-i", inputPath}
+	maps := []string{"-map", "0:a"}
+	if meta != nil && meta.CoverPath != "" {
+		if _, err := os.Stat(meta.CoverPath); err == nil {
+			args = append(args, "-i", meta.CoverPath)
+			maps = append(maps, "-map", "1", "-disposition:v:0", "attached_pic")
+		}
+	}
+	args = append(args, maps...)
+	args = append(args, "-c", "copy")
+	if strings.EqualFold(filepath.Ext(outputPath), ".mp3") {
+		args = append(args, "-id3v2_version", "3")
+	}
+	args = append(args, meta.ffmpegArgs(outputPath)...)
+	args = append(args, "-y", outputPath)
+
+	cmd := exec.Command(ffmpegPath, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
+// Remux 不重新编码地将 inputPath 转封装为 outputPath（格式由扩展名决定），用于直播录像转 MP4
+func Remux(inputPath, outputPath string) error {
+	ffmpegPath, err := findFFmpegPath()
+	if err != nil {
+		return fmt.Errorf("找不到FFmpeg: %w", err)
+	}
+	args := []string{"-i", inputPath, "-map", "0", "-c", "copy"}
+	if isMP4(outputPath) {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, "-y", outputPath)
+	cmd := exec.Command(ffmpegPath, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// ffmpegOverride 用户在设置中指定的 FFmpeg 路径
+var ffmpegOverride string
+
+// SetFFmpegPath 指定 FFmpeg 可执行文件路径，为空时恢复自动查找
+func SetFFmpegPath(path string) {
+	ffmpegOverride = path
+}
+
 // findFFmpegPath 查找FFmpeg可执行文件的路径
 func findFFmpegPath() (string, error) {
 	// 查找策略按优先级排序：
+	// 0. 用户设置中指定的FFmpeg
 	// 1. 应用程序包内的FFmpeg（用于DMG分发）
 	// 2. 当前工作目录的FFmpeg
 	// 3. 系统PATH中的FFmpeg
 
+	// 0. 用户指定的路径不存在时直接报错，避免静默使用其他版本
+	if ffmpegOverride != "" {
+		if _, err := os.Stat(ffmpegOverride); err != nil {
+			return "", fmt.Errorf("设置的FFmpeg路径不可用: %w", err)
+		}
+		return ffmpegOverride, nil
+	}
+
 	// 1. 检查应用程序包内的FFmpeg
 	if bundledPath := getBundledFFmpegPath(); bundledPath != "" {
 		if _, err := os.Stat(bundledPath); err == nil {
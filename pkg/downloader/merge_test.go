@@ -0,0 +1,91 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeArgs(t *testing.T) {
+	dir := t.TempDir()
+	cover := filepath.Join(dir, "cover.jpg")
+	if err := os.WriteFile(cover, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chapters := []Chapter{{Title: "开头", Start: 0, End: 10 * time.Second}}
+	inputs := []string{"-i", "v.m4s", "-i", "a.m4s"}
+	maps := []string{"-map", "0:v", "-map", "1:a"}
+
+	tests := []struct {
+		name    string
+		output  string
+		meta    *Metadata
+		want    []string // 按顺序出现的参数片段
+		without []string
+	}{
+		{
+			name:    "mp4 without metadata",
+			output:  "out.mp4",
+			want:    []string{"-map 0:v -map 1:a -c copy -strict experimental -y"},
+			without: []string{"-attach", "attached_pic"},
+		},
+		{
+			name:    "mp4 cover",
+			output:  "out.mp4",
+			meta:    &Metadata{Title: "标题", CoverPath: cover},
+			want:    []string{"-i " + cover, "-map 2", "-c copy -disposition:v:1 attached_pic -strict experimental", "-metadata title=标题"},
+			without: []string{"-attach"},
+		},
+		{
+			name:    "mkv cover",
+			output:  "out.mkv",
+			meta:    &Metadata{CoverPath: cover, BVID: "BV17x411w7KC"},
+			want:    []string{"-c copy -attach " + cover + " -metadata:s:t mimetype=image/jpeg -metadata:s:t filename=cover.jpg", "-metadata bvid=BV17x411w7KC"},
+			without: []string{"attached_pic", "-strict", "-map 2"},
+		},
+		{
+			name:    "missing cover",
+			output:  "out.mkv",
+			meta:    &Metadata{CoverPath: filepath.Join(dir, "missing.jpg")},
+			without: []string{"-attach", "attached_pic"},
+		},
+		{
+			name:   "chapters and mp4 cover",
+			output: "out.mp4",
+			meta:   &Metadata{Chapters: chapters, CoverPath: cover},
+			want:   []string{"-i .ffmeta -i " + cover, "-map 3", "-map_chapters 2 -disposition:v:1 attached_pic"},
+		},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(dir, tt.output)
+		args, err := mergeArgs(slices.Clone(inputs), slices.Clone(maps), 2, output, tt.meta)
+		if err != nil {
+			t.Errorf("%s: mergeArgs error: %v", tt.name, err)
+			continue
+		}
+		if args[len(args)-1] != output {
+			t.Errorf("%s: last argument = %q, want output path", tt.name, args[len(args)-1])
+		}
+		line := strings.ReplaceAll(strings.Join(args, " "), chapterFilePath(output), ".ffmeta")
+		for _, w := range tt.want {
+			if !strings.Contains(line, w) {
+				t.Errorf("%s: args missing %q:\n%s", tt.name, w, line)
+			}
+		}
+		for _, w := range tt.without {
+			if strings.Contains(line, w) {
+				t.Errorf("%s: args should not contain %q:\n%s", tt.name, w, line)
+			}
+		}
+		os.Remove(chapterFilePath(output))
+	}
+}
+
+func TestMkvPath(t *testing.T) {
+	if got := mkvPath(filepath.Join("tmp", "BV1_merged.mp4")); got != filepath.Join("tmp", "BV1_merged.mkv") {
+		t.Errorf("mkvPath = %q", got)
+	}
+}
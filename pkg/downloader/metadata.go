@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dilidili/pkg/api"
+)
+
+// Metadata 写入输出文件的容器元数据
+type Metadata struct {
+	Title       string
+	Uploader    string
+	Description string
+	BVID        string
+	SourceURL   string
+	Category    string
+	PublishDate time.Time
+	Tags        []string
+	CoverPath   string // 封面图片路径，为空时不嵌入封面
+	Chapters    []Chapter
+	Lyrics      string // 音频区单曲的 LRC 歌词
+}
+
+// NewMetadata 根据 GetVideoInfo 返回的数据构造元数据
+func NewMetadata(info *api.VideoInfo, tags []string) *Metadata {
+	m := &Metadata{
+		Title:       info.Data.Title,
+		Uploader:    info.Data.Owner.Name,
+		Description: info.Data.Desc,
+		BVID:        info.Data.Bvid,
+		SourceURL:   info.Data.Ref.URL(),
+		Category:    info.Data.Tname,
+		Tags:        tags,
+	}
+	if info.Data.Pubdate > 0 {
+		m.PublishDate = time.Unix(info.Data.Pubdate, 0)
+	}
+	return m
+}
+
+// ffmpegArgs 生成写入元数据所需的 ffmpeg 参数，放在输出文件名之前
+func (m *Metadata) ffmpegArgs(outputPath string) []string {
+	if m == nil {
+		return nil
+	}
+	var args []string
+	add := func(key, value string) {
+		if value != "" {
+			args = append(args, "-metadata", key+"="+value)
+		}
+	}
+	add("title", m.Title)
+	add("artist", m.Uploader)
+	add("album_artist", m.Uploader)
+	add("description", m.Description)
+	add("synopsis", m.Description)
+	add("comment", m.SourceURL)
+	add("genre", m.Category)
+	add("keywords", strings.Join(m.Tags, ","))
+	add("lyrics", m.Lyrics)
+	if !m.PublishDate.IsZero() {
+		add("date", m.PublishDate.Format("2006-01-02"))
+	}
+	// MP4 只有标准的 iTunes 标签能被播放器读取，use_metadata_tags 会把所有键改写为 mdta，
+	// 因此 MP4 不写自定义键，BV 号和来源链接已包含在 comment 中
+	if !isMP4(outputPath) {
+		add("bvid", m.BVID)
+		add("purl", m.SourceURL)
+	}
+	return args
+}
+
+// isMP4 判断输出文件是否为 MP4 容器
+func isMP4(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".m4v", ".m4a", ".mov":
+		return true
+	}
+	return false
+}
+
+// isMKV 判断输出文件是否为 Matroska 容器
+func isMKV(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mkv", ".mka":
+		return true
+	}
+	return false
+}
+
+// coverMimeType 根据扩展名推断封面图片类型
+func coverMimeType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
@@ -0,0 +1,236 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stream 进度所属的流
+type Stream int
+
+const (
+	StreamVideo Stream = iota
+	StreamAudio
+)
+
+func (s Stream) String() string {
+	if s == StreamAudio {
+		return "音频"
+	}
+	return "视频"
+}
+
+// Phase 单个流所处的阶段
+type Phase int
+
+const (
+	PhaseConnecting  Phase = iota // 正在建立连接
+	PhaseDownloading              // 正在接收数据
+	PhaseRetrying                 // 出错后等待重试
+	PhaseFinished                 // 已下载完成
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseConnecting:
+		return "连接中"
+	case PhaseDownloading:
+		return "下载中"
+	case PhaseRetrying:
+		return "等待重试"
+	case PhaseFinished:
+		return "已完成"
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// Progress 单个流的详细下载进度
+type Progress struct {
+	Stream   Stream
+	Phase    Phase
+	Done     int64         // 已下载字节数
+	Total    int64         // 总字节数，未知时为 -1
+	Speed    float64       // 最近一个采样周期的瞬时速度（字节/秒）
+	AvgSpeed float64       // 指数平滑后的速度（字节/秒）
+	ETA      time.Duration // 预计剩余时间，未知时为 -1
+}
+
+// Fraction 返回完成比例，总大小未知时返回 -1
+func (p Progress) Fraction() float64 {
+	if p.Phase == PhaseFinished {
+		return 1
+	}
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Done) / float64(p.Total)
+}
+
+// Summary 返回形如 "12.3 MB / 45.6 MB  2.1 MB/s  剩余 0:15" 的进度描述
+func (p Progress) Summary() string {
+	var b strings.Builder
+	b.WriteString(FormatBytes(p.Done))
+	if p.Total > 0 {
+		b.WriteString(" / " + FormatBytes(p.Total))
+	}
+	switch p.Phase {
+	case PhaseDownloading:
+		fmt.Fprintf(&b, "  %s/s", FormatBytes(int64(p.AvgSpeed)))
+		if p.ETA >= 0 {
+			b.WriteString("  剩余 " + formatETA(p.ETA))
+		}
+	default:
+		b.WriteString("  " + p.Phase.String())
+	}
+	return b.String()
+}
+
+// DetailedProgressHandler 可选接口，ProgressHandler 同时实现时额外收到详细进度；
+// 只实现 ProgressHandler 的旧代码仍通过 SetVideoProgress 等收到完成比例
+type DetailedProgressHandler interface {
+	OnProgress(p Progress)
+}
+
+// FormatBytes 将字节数格式化为易读的字符串
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+const (
+	// sampleInterval 速度采样和进度回调的最小间隔
+	sampleInterval = 250 * time.Millisecond
+	// speedSmoothing 指数平滑系数，越大越偏向最新的瞬时速度
+	speedSmoothing = 0.3
+)
+
+// progressTracker 统计单个流的字节数和速度，并节流地发出 Progress
+type progressTracker struct {
+	mu       sync.Mutex
+	p        Progress
+	lastTime time.Time
+	lastDone int64
+	emit     func(Progress)
+}
+
+func newProgressTracker(stream Stream, emit func(Progress)) *progressTracker {
+	if emit == nil {
+		emit = func(Progress) {}
+	}
+	return &progressTracker{p: Progress{Stream: stream, Total: -1, ETA: -1}, emit: emit}
+}
+
+// start 在每次（重新）发起请求后调用，done 为续传起点，total 未知时传 -1
+func (t *progressTracker) start(done, total int64) {
+	t.mu.Lock()
+	t.p.Phase = PhaseDownloading
+	t.p.Done = done
+	t.p.Total = total
+	t.lastDone = done
+	t.lastTime = time.Now()
+	p := t.p
+	t.mu.Unlock()
+	t.emit(p)
+}
+
+// add 记录新收到的 n 个字节
+func (t *progressTracker) add(n int) {
+	t.mu.Lock()
+	t.p.Done += int64(n)
+	now := time.Now()
+	elapsed := now.Sub(t.lastTime)
+	if elapsed < sampleInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.p.Speed = float64(t.p.Done-t.lastDone) / elapsed.Seconds()
+	if t.p.AvgSpeed == 0 {
+		t.p.AvgSpeed = t.p.Speed
+	} else {
+		t.p.AvgSpeed = speedSmoothing*t.p.Speed + (1-speedSmoothing)*t.p.AvgSpeed
+	}
+	t.p.ETA = -1
+	if t.p.Total > 0 && t.p.AvgSpeed > 0 {
+		t.p.ETA = time.Duration(float64(t.p.Total-t.p.Done) / t.p.AvgSpeed * float64(time.Second))
+	}
+	t.lastDone = t.p.Done
+	t.lastTime = now
+	p := t.p
+	t.mu.Unlock()
+	t.emit(p)
+}
+
+// setPhase 切换阶段并立即发出一次进度
+func (t *progressTracker) setPhase(phase Phase) {
+	t.mu.Lock()
+	t.p.Phase = phase
+	if phase == PhaseFinished {
+		t.p.ETA = 0
+		if t.p.Total < 0 {
+			t.p.Total = t.p.Done
+		}
+	}
+	p := t.p
+	t.mu.Unlock()
+	t.emit(p)
+}
+
+// progressAdapter 将详细进度分发给处理器：旧接口收到完成比例，
+// 实现了 DetailedProgressHandler 的处理器额外收到 Progress，
+// 并根据两个流的字节数估算总体进度（下载阶段占 80%）
+type progressAdapter struct {
+	mu      sync.Mutex
+	handler ProgressHandler
+	streams map[Stream]Progress
+	count   int // 需要下载的流的个数，durl 分段和音频区单曲只有一个
+}
+
+func newProgressAdapter(handler ProgressHandler) *progressAdapter {
+	return &progressAdapter{handler: handler, streams: map[Stream]Progress{}, count: 2}
+}
+
+func (a *progressAdapter) report(p Progress) {
+	if f := p.Fraction(); f >= 0 {
+		switch p.Stream {
+		case StreamVideo:
+			a.handler.SetVideoProgress(f)
+		case StreamAudio:
+			a.handler.SetAudioProgress(f)
+		}
+	}
+	if dh, ok := a.handler.(DetailedProgressHandler); ok {
+		dh.OnProgress(p)
+	}
+
+	a.mu.Lock()
+	a.streams[p.Stream] = p
+	var done, total int64
+	known := len(a.streams) == a.count
+	for _, s := range a.streams {
+		done += s.Done
+		total += s.Total
+		known = known && s.Total > 0
+	}
+	a.mu.Unlock()
+	if known {
+		a.handler.SetOverallProgress(0.8 * float64(done) / float64(total))
+	}
+}
@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"dilidili/pkg/api"
+)
+
+// Result 一次下载完成后最终文件的信息
+type Result struct {
+	BVID        string
+	Cid         int
+	Page        int
+	Title       string
+	Uploader    string
+	Quality     int
+	VideoCodec  string
+	AudioCodec  string
+	Path        string
+	Size        int64
+	SHA256      string
+	PublishedAt time.Time
+}
+
+// newResult 根据视频信息和输出文件的摘要构造结果
+func newResult(info *api.VideoInfo, file fileDigest) *Result {
+	res := &Result{
+		BVID:     info.Data.Bvid,
+		Cid:      info.Data.Cid,
+		Page:     1,
+		Title:    info.Data.Title,
+		Uploader: info.Data.Owner.Name,
+		Path:     file.path,
+		Size:     file.size,
+		SHA256:   file.sum,
+	}
+	for _, p := range info.Data.Pages {
+		if p.Cid == info.Data.Cid {
+			res.Page = p.Page
+		}
+	}
+	if info.Data.Pubdate > 0 {
+		res.PublishedAt = time.Unix(info.Data.Pubdate, 0)
+	}
+	return res
+}
+
+// fileDigest 文件的大小和十六进制 SHA-256
+type fileDigest struct {
+	path string
+	size int64
+	sum  string
+}
+
+// outputDigests 计算输出文件的摘要，每个文件只读取一次。设置了输出目录时计算全部文件
+// 并写入 .sha256 校验文件；否则只在需要下载结果时计算主文件，都不需要时返回 nil。
+// 返回的第一项为主文件
+func outputDigests(files []string, opts Options, needResult bool, handler ProgressHandler) ([]fileDigest, error) {
+	switch {
+	case opts.OutputDir != "":
+	case needResult:
+		files = files[:1]
+	default:
+		return nil, nil
+	}
+	digests := make([]fileDigest, 0, len(files))
+	for _, p := range files {
+		size, sum, err := hashFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("读取输出文件失败: %w", err)
+		}
+		digests = append(digests, fileDigest{path: p, size: size, sum: sum})
+	}
+	if opts.OutputDir != "" {
+		if _, err := writeChecksums(digests); err != nil {
+			handler.SetStatus(fmt.Sprintf("写入校验文件失败: %v", err))
+		}
+	}
+	return digests, nil
+}
+
+// hashFile 返回文件大小和十六进制 SHA-256
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
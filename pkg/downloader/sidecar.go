@@ -0,0 +1,121 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+
+	"dilidili/pkg/api"
+)
+
+// infoSidecar 写入 .info.json 的视频信息，在 view 接口数据的基础上补充分 P、标签和来源
+type infoSidecar struct {
+	*api.VideoData
+	Page      int      `json:"page"`
+	Part      string   `json:"part,omitempty"`
+	Tags      []string `json:"tags"`
+	URL       string   `json:"webpage_url"`
+	FetchedAt int64    `json:"fetched_at"` // 获取信息的时间，播放数等数据以此时为准
+}
+
+// WriteInfoJSON 将视频信息写入 base.info.json，返回文件路径
+func WriteInfoJSON(info *api.VideoInfo, tags []string, base string) (string, error) {
+	page := currentPage(info)
+	side := infoSidecar{
+		VideoData: &info.Data,
+		Page:      page.Page,
+		Part:      page.Part,
+		Tags:      tags,
+		URL:       info.Data.Ref.URL(),
+		FetchedAt: time.Now().Unix(),
+	}
+	if side.Tags == nil {
+		side.Tags = []string{}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(side); err != nil {
+		return "", err
+	}
+	path := base + ".info.json"
+	return path, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// nfoMovie Kodi 格式的电影 NFO，Jellyfin、Emby 和 Plex（XBMCnfoMoviesImporter）均可读取
+type nfoMovie struct {
+	XMLName   xml.Name   `xml:"movie"`
+	Title     string     `xml:"title"`
+	Plot      string     `xml:"plot,omitempty"`
+	Runtime   int        `xml:"runtime,omitempty"` // 分钟
+	Thumb     string     `xml:"thumb,omitempty"`
+	Premiered string     `xml:"premiered,omitempty"`
+	Year      int        `xml:"year,omitempty"`
+	Studio    string     `xml:"studio,omitempty"`
+	Genre     string     `xml:"genre,omitempty"`
+	Tags      []string   `xml:"tag"`
+	UniqueID  nfoID      `xml:"uniqueid"`
+	Actors    []nfoActor `xml:"actor"`
+}
+
+type nfoID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr"`
+	Value   string `xml:",chardata"`
+}
+
+type nfoActor struct {
+	Name  string `xml:"name"`
+	Role  string `xml:"role,omitempty"`
+	Thumb string `xml:"thumb,omitempty"`
+}
+
+// WriteNFO 写入与视频同名的 base.nfo，媒体服务器据此显示标题、简介、UP 主和标签。
+// UP 主写为制片公司，联合投稿的成员写为演员
+func WriteNFO(info *api.VideoInfo, tags []string, base string) (string, error) {
+	d := &info.Data
+	page := currentPage(info)
+	m := nfoMovie{
+		Title:    d.Title,
+		Plot:     d.Desc,
+		Runtime:  (int(expectedDuration(info).Seconds()) + 59) / 60,
+		Studio:   d.Owner.Name,
+		Genre:    d.Tname,
+		Tags:     tags,
+		UniqueID: nfoID{Type: "bilibili", Default: true, Value: d.Bvid},
+	}
+	if len(d.Pages) > 1 {
+		m.Title = fmt.Sprintf("%s - P%d %s", d.Title, page.Page, page.Part)
+	}
+	if d.Pic != "" {
+		m.Thumb = api.OriginalImageURL(d.Pic)
+	}
+	if d.Pubdate > 0 {
+		date := time.Unix(d.Pubdate, 0)
+		m.Premiered = date.Format("2006-01-02")
+		m.Year = date.Year()
+	}
+	for _, s := range d.Staff {
+		m.Actors = append(m.Actors, nfoActor{Name: s.Name, Role: s.Title, Thumb: s.Face})
+	}
+	data, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := base + ".nfo"
+	return path, os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+// currentPage 返回 info.Data.Cid 对应的分 P，找不到时视为第一个分 P
+func currentPage(info *api.VideoInfo) api.Page {
+	for _, p := range info.Data.Pages {
+		if p.Cid == info.Data.Cid {
+			return p
+		}
+	}
+	return api.Page{Cid: info.Data.Cid, Page: 1}
+}
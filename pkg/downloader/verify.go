@@ -0,0 +1,195 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// verifyFMP4 检查 DASH 分片（.m4s）的顶层 box 结构：必须以 ftyp 开头，包含 moov 和 mdat，
+// 且所有 box 的长度之和恰好等于文件大小。截断或损坏的文件会在这里被发现
+func verifyFMP4(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	seen := map[string]bool{}
+	var offset int64
+	header := make([]byte, 16)
+	for offset < size {
+		if size-offset < 8 {
+			return fmt.Errorf("%s: 偏移 %d 处剩余 %d 字节，不足一个 box 头", filepath.Base(path), offset, size-offset)
+		}
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		switch boxSize {
+		case 0: // 延伸到文件末尾
+			boxSize = size - offset
+		case 1: // 64 位长度
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return fmt.Errorf("%s: 读取 %s 的 64 位长度失败: %w", filepath.Base(path), boxType, err)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if boxSize < 8 || offset+boxSize > size {
+			return fmt.Errorf("%s: %q box 长度 %d 超出文件范围（偏移 %d，文件 %d 字节）",
+				filepath.Base(path), boxType, boxSize, offset, size)
+		}
+		if offset == 0 && boxType != "ftyp" {
+			return fmt.Errorf("%s: 文件不是以 ftyp 开头（%q）", filepath.Base(path), boxType)
+		}
+		seen[boxType] = true
+		offset += boxSize
+	}
+	for _, required := range []string{"moov", "mdat"} {
+		if !seen[required] {
+			return fmt.Errorf("%s: 缺少 %s box", filepath.Base(path), required)
+		}
+	}
+	return nil
+}
+
+// mediaInfo 从 ffmpeg 输出中解析出的媒体信息
+type mediaInfo struct {
+	Duration time.Duration
+	HasVideo bool
+	HasAudio bool
+}
+
+var (
+	durationPattern = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+	streamPattern   = regexp.MustCompile(`Stream #\d+:\d+.*?: (Video|Audio):`)
+)
+
+// probeMedia 用 ffmpeg -i 读取文件的时长和流信息（效果等同于 ffprobe，但只依赖内置的 ffmpeg）
+func probeMedia(path string) (*mediaInfo, error) {
+	ffmpegPath, err := findFFmpegPath()
+	if err != nil {
+		return nil, fmt.Errorf("找不到FFmpeg: %w", err)
+	}
+	// 不指定输出文件时 ffmpeg 以非零状态退出，这里只关心它打印的文件信息
+	out, _ := exec.Command(ffmpegPath, "-hide_banner", "-i", path).CombinedOutput()
+
+	info := &mediaInfo{}
+	m := durationPattern.FindSubmatch(out)
+	if m == nil {
+		return nil, fmt.Errorf("无法读取 %s 的时长", filepath.Base(path))
+	}
+	h, _ := strconv.Atoi(string(m[1]))
+	min, _ := strconv.Atoi(string(m[2]))
+	sec, _ := strconv.ParseFloat(string(m[3]), 64)
+	info.Duration = time.Duration(h)*time.Hour + time.Duration(min)*time.Minute +
+		time.Duration(sec*float64(time.Second))
+
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// 嵌入的封面也表现为视频流，不计入
+		if strings.Contains(line, "attached pic") {
+			continue
+		}
+		if s := streamPattern.FindStringSubmatch(line); s != nil {
+			switch s[1] {
+			case "Video":
+				info.HasVideo = true
+			case "Audio":
+				info.HasAudio = true
+			}
+		}
+	}
+	return info, nil
+}
+
+// durationTolerance 合并结果与 API 时长允许的误差：2 秒或时长的 1%，取较大者
+func durationTolerance(expected time.Duration) time.Duration {
+	tol := expected / 100
+	if tol < 2*time.Second {
+		tol = 2 * time.Second
+	}
+	return tol
+}
+
+// verifyOutput 检查合并后的文件同时包含音视频轨，且时长与 API 给出的时长一致；
+// expected 为 0 时跳过时长检查
+func verifyOutput(path string, expected time.Duration) error {
+	return verifyMedia(path, expected, true)
+}
+
+// verifyMedia 同 verifyOutput，video 为 false 时只要求音频轨，用于音频区单曲
+func verifyMedia(path string, expected time.Duration, video bool) error {
+	info, err := probeMedia(path)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	if video && !info.HasVideo {
+		problems = append(problems, "缺少视频轨")
+	}
+	if !info.HasAudio {
+		problems = append(problems, "缺少音频轨")
+	}
+	if expected > 0 {
+		diff := info.Duration - expected
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > durationTolerance(expected) {
+			problems = append(problems, fmt.Sprintf("时长 %s 与预期 %s 不符",
+				info.Duration.Round(time.Second), expected.Round(time.Second)))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s 校验失败: %s", filepath.Base(path), strings.Join(problems, "，"))
+	}
+	return nil
+}
+
+// writeChecksums 以 sha256sum 兼容格式将各文件的 SHA-256 写入 <第一个文件>.sha256
+func writeChecksums(files []fileDigest) (string, error) {
+	if len(files) == 0 {
+		return "", errors.New("没有需要记录校验值的文件")
+	}
+	target := files[0].path + ".sha256"
+	f, err := os.Create(target)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, file := range files {
+		// 使用相对于校验文件所在目录的路径，便于整体移动后用 sha256sum -c 校验
+		rel, err := filepath.Rel(filepath.Dir(target), file.path)
+		if err != nil {
+			rel = filepath.Base(file.path)
+		}
+		fmt.Fprintf(w, "%s  %s\n", file.sum, filepath.ToSlash(rel))
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// errIncomplete 收到的字节数与 Content-Length 不一致，按截断处理（可重试并续传）
+func errIncomplete(got, want int64) error {
+	return fmt.Errorf("下载不完整，收到 %d 字节，预期 %d 字节: %w", got, want, io.ErrUnexpectedEOF)
+}
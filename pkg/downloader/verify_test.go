@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationTolerance(t *testing.T) {
+	tests := []struct {
+		expected time.Duration
+		want     time.Duration
+	}{
+		{0, 2 * time.Second},
+		{30 * time.Second, 2 * time.Second},
+		{200 * time.Second, 2 * time.Second},
+		{300 * time.Second, 3 * time.Second},
+		{2 * time.Hour, 72 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := durationTolerance(tt.expected); got != tt.want {
+			t.Errorf("durationTolerance(%s) = %s, want %s", tt.expected, got, tt.want)
+		}
+	}
+}
+
+// box 按 32 位长度封装一个 box
+func box(typ string, payload ...byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	copy(b[4:], typ)
+	return append(b, payload...)
+}
+
+// largeBox 按 64 位长度封装一个 box
+func largeBox(typ string, payload ...byte) []byte {
+	b := make([]byte, 16, 16+len(payload))
+	binary.BigEndian.PutUint32(b, 1)
+	copy(b[4:], typ)
+	binary.BigEndian.PutUint64(b[8:], uint64(16+len(payload)))
+	return append(b, payload...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestVerifyFMP4(t *testing.T) {
+	ftyp := box("ftyp", 'i', 's', 'o', '5', 0, 0, 0, 1)
+	moov := box("moov", box("mvhd", 0, 0, 0, 0)...)
+	mdat := box("mdat", 1, 2, 3, 4)
+	toEnd := []byte{0, 0, 0, 0, 'm', 'd', 'a', 't', 9, 9, 9}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string // 为空表示应通过校验
+	}{
+		{"complete", concat(ftyp, moov, box("moof"), mdat), ""},
+		{"64-bit mdat", concat(ftyp, moov, largeBox("mdat", 1, 2, 3)), ""},
+		{"mdat to end of file", concat(ftyp, moov, toEnd), ""},
+		{"truncated mdat", concat(ftyp, moov, mdat[:len(mdat)-1]), "超出文件范围"},
+		{"trailing bytes", concat(ftyp, moov, mdat, []byte{0, 0, 0}), "不足一个 box 头"},
+		{"no ftyp", concat(moov, ftyp, mdat), "不是以 ftyp 开头"},
+		{"no moov", concat(ftyp, mdat), "缺少 moov"},
+		{"no mdat", concat(ftyp, moov), "缺少 mdat"},
+		{"box smaller than header", concat(ftyp, []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}), "超出文件范围"},
+		{"empty", nil, "缺少 moov"},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".m4s")
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := verifyFMP4(path)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%d %s: verifyFMP4 error: %v", i, tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%d %s: verifyFMP4 error = %v, want %q", i, tt.name, err, tt.err)
+		}
+	}
+	if err := verifyFMP4(filepath.Join(dir, "missing.m4s")); err == nil {
+		t.Error("verifyFMP4(missing file) error = nil")
+	}
+}
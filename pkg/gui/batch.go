@@ -0,0 +1,124 @@
+package gui
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+
+	"dilidili/pkg/batch"
+	"dilidili/pkg/queue"
+)
+
+// showBatchImport 选择导入文件，校验全部行后将有效的条目加入队列
+func (ui *downloadUI) showBatchImport() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+		items, err := batch.Parse(reader)
+		if len(items) == 0 {
+			if err == nil {
+				err = errors.New("文件中没有视频链接")
+			}
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if err != nil {
+			msg := fmt.Sprintf("以下行无效:\n%v\n\n是否导入其余 %d 条？", err, len(items))
+			dialog.ShowConfirm("批量导入", msg, func(ok bool) {
+				if ok {
+					ui.importBatch(items)
+				}
+			}, ui.window)
+			return
+		}
+		ui.importBatch(items)
+	}, ui.window)
+}
+
+// importBatch 在后台解析短链接和分P列表，然后将任务加入队列，全部结束后显示汇总
+func (ui *downloadUI) importBatch(items []batch.Item) {
+	ui.SetStatus(fmt.Sprintf("正在解析 %d 条链接...", len(items)))
+	opts := ui.settings.DownloadOptions()
+	go func() {
+		tasks, expandErrs := batch.ExpandAll(items, opts)
+		fyne.Do(func() {
+			tracker := &batchTracker{ui: ui, expandErrs: expandErrs}
+			skipped := 0
+			for _, t := range tasks {
+				ref := t.Ref()
+				if ui.isQueued(ref) || ui.isDownloaded(ref) {
+					skipped++
+					continue
+				}
+				job := ui.queue.Add(t.Kind, t.ID, t.Options, batchHandler{ui.newJobHandler(ref, t.Options), tracker})
+				tracker.add(job)
+			}
+			ui.SetStatus(fmt.Sprintf("已加入 %d 个任务，跳过 %d 个已下载或已在队列中的视频", len(tasks)-skipped, skipped))
+			tracker.seal()
+		})
+	}()
+}
+
+// batchHandler 在界面处理器之外跟踪批量任务的状态
+type batchHandler struct {
+	*jobHandler
+	tracker *batchTracker
+}
+
+func (h batchHandler) OnStateChange(job *queue.Job) {
+	h.jobHandler.OnStateChange(job)
+	h.tracker.check()
+}
+
+// batchTracker 一批任务全部结束（完成、失败或取消）后显示一次汇总
+type batchTracker struct {
+	ui         *downloadUI
+	mu         sync.Mutex
+	jobs       []*queue.Job
+	expandErrs []error
+	sealed     bool
+	reported   bool
+}
+
+func (t *batchTracker) add(job *queue.Job) {
+	t.mu.Lock()
+	t.jobs = append(t.jobs, job)
+	t.mu.Unlock()
+}
+
+// seal 表示所有任务都已加入
+func (t *batchTracker) seal() {
+	t.mu.Lock()
+	t.sealed = true
+	t.mu.Unlock()
+	t.check()
+}
+
+func (t *batchTracker) check() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.sealed || t.reported {
+		return
+	}
+	for _, job := range t.jobs {
+		switch job.State() {
+		case queue.Done, queue.Failed, queue.Canceled:
+		default:
+			return
+		}
+	}
+	t.reported = true
+	summary := batch.Summary(t.jobs, t.expandErrs)
+	fyne.Do(func() {
+		dialog.ShowInformation("批量导入完成", summary, t.ui.window)
+	})
+}
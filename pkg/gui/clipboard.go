@@ -0,0 +1,154 @@
+package gui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/queue"
+	"dilidili/pkg/utils"
+)
+
+// clipboardInterval 检查剪贴板的间隔
+const clipboardInterval = time.Second
+
+// clipboardWatcher 定期检查剪贴板中的 B 站链接，在主界面顶部提示加入队列，
+// 或在开启自动加入时直接加入。除 stop 外的字段只在主线程访问
+type clipboardWatcher struct {
+	ui      *downloadUI
+	bar     *fyne.Container
+	label   *widget.Label
+	last    string
+	seen    map[string]bool
+	pending []utils.VideoRef
+	stop    chan struct{}
+}
+
+func newClipboardWatcher(ui *downloadUI) *clipboardWatcher {
+	w := &clipboardWatcher{ui: ui, label: widget.NewLabel(""), seen: map[string]bool{}}
+	w.label.Wrapping = fyne.TextWrapWord
+	add := widget.NewButton("加入队列", func() {
+		for _, ref := range w.pending {
+			ui.startDownload(ref)
+		}
+		w.dismiss()
+	})
+	ignore := widget.NewButton("忽略", w.dismiss)
+	w.bar = container.NewBorder(nil, nil, nil, container.NewHBox(add, ignore), w.label)
+	w.bar.Hide()
+	return w
+}
+
+// apply 按偏好设置开启或停止监视，在主线程调用
+func (w *clipboardWatcher) apply() {
+	enabled := w.ui.prefs.BoolWithFallback(prefClipboardWatch, false)
+	switch {
+	case enabled && w.stop == nil:
+		// 开启前已在剪贴板中的内容不算新复制的链接
+		w.last = fyne.CurrentApp().Clipboard().Content()
+		w.stop = make(chan struct{})
+		go w.run(w.stop)
+	case !enabled && w.stop != nil:
+		close(w.stop)
+		w.stop = nil
+		w.dismiss()
+	}
+}
+
+func (w *clipboardWatcher) run(stop chan struct{}) {
+	ticker := time.NewTicker(clipboardInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		var text string
+		changed := false
+		fyne.DoAndWait(func() {
+			text = fyne.CurrentApp().Clipboard().Content()
+			changed = text != w.last
+			w.last = text
+		})
+		if !changed {
+			continue
+		}
+		// 短链接需要联网解析，放在后台完成
+		var refs []utils.VideoRef
+		for _, link := range utils.FindVideoLinks(text) {
+			if ref, err := api.ResolveVideoRef(link); err == nil {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) > 0 {
+			fyne.Do(func() { w.offer(refs) })
+		}
+	}
+}
+
+// offer 过滤掉已提示过、已在队列中或已下载过的视频，其余按设置提示或直接加入队列
+func (w *clipboardWatcher) offer(refs []utils.VideoRef) {
+	auto := w.ui.prefs.BoolWithFallback(prefClipboardAuto, false)
+	for _, ref := range refs {
+		key := fmt.Sprintf("%s#%d", ref.Key(), max(ref.Page, 1))
+		if w.seen[key] || w.ui.isQueued(ref) || w.ui.isDownloaded(ref) {
+			continue
+		}
+		w.seen[key] = true
+		if auto {
+			w.ui.startDownload(ref)
+			continue
+		}
+		w.pending = append(w.pending, ref)
+	}
+	if len(w.pending) == 0 {
+		return
+	}
+	names := make([]string, len(w.pending))
+	for i, ref := range w.pending {
+		names[i] = ref.Key()
+		if ref.Page > 1 {
+			names[i] += fmt.Sprintf(" P%d", ref.Page)
+		}
+	}
+	w.label.SetText(fmt.Sprintf("剪贴板中发现 %d 个视频: %s", len(w.pending), strings.Join(names, "、")))
+	w.bar.Show()
+}
+
+func (w *clipboardWatcher) dismiss() {
+	w.pending = nil
+	w.bar.Hide()
+}
+
+// isQueued 视频（分P）是否已在队列中等待或下载
+func (ui *downloadUI) isQueued(ref utils.VideoRef) bool {
+	for _, job := range ui.queue.Jobs() {
+		if job.Kind != ref.Kind || job.VideoID != ref.ID || max(job.Options.Page, 1) != max(ref.Page, 1) {
+			continue
+		}
+		switch job.State() {
+		case queue.Pending, queue.Running, queue.Paused:
+			return true
+		}
+	}
+	return false
+}
+
+// isDownloaded 媒体库中是否已有该视频（分P）且文件仍存在
+func (ui *downloadUI) isDownloaded(ref utils.VideoRef) bool {
+	if ui.lib == nil {
+		return false
+	}
+	for _, e := range ui.lib.Find(ref.Key(), max(ref.Page, 1)) {
+		if e.Exists() {
+			return true
+		}
+	}
+	return false
+}
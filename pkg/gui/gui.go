@@ -1,10 +1,12 @@
 package gui
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"strings"
+	"path/filepath"
+	"sync/atomic"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -13,7 +15,13 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 
+	"dilidili/pkg/api"
+	"dilidili/pkg/batch"
+	"dilidili/pkg/config"
 	"dilidili/pkg/downloader"
+	"dilidili/pkg/instance"
+	"dilidili/pkg/library"
+	"dilidili/pkg/queue"
 	"dilidili/pkg/utils"
 )
 
@@ -21,86 +29,242 @@ type downloadUI struct {
 	window          fyne.Window
 	entry           *widget.Entry
 	downloadBtn     *widget.Button
-	saveBtn         *widget.Button
+	saveList        *fyne.Container // 未设置输出目录时，每个完成的任务一行保存按钮
+	coverPreview    *canvas.Image
 	statusLabel     *widget.Label
 	videoProgress   *widget.ProgressBar
 	audioProgress   *widget.ProgressBar
 	overallProgress *widget.ProgressBar
-	bvid            string
-	title           string
+	videoDetail     *widget.Label
+	audioDetail     *widget.Label
+	prefs           fyne.Preferences
+	settings        config.Settings // 运行中使用的设置，含环境变量的覆盖
+	stored          config.Settings // 偏好设置中保存的设置
+	lib             *library.Library
+	queue           *queue.Queue
+	rateSelect      *widget.Select
+	rates           []string // rateSelect 各选项对应的限速设置
+	clipboard       *clipboardWatcher
+	live            *liveTab
+	current         atomic.Pointer[jobHandler] // 进度条显示的任务
+	historyEntries  []library.Entry
+	refreshHistory  func()
 }
 
-func (ui *downloadUI) SetVideoProgress(p float64) {
-	ui.videoProgress.SetValue(p)
+// jobHandler 单个下载任务的界面回调，保存该任务自己的状态。
+// 界面只有一组进度条，多个任务同时下载时显示最近开始的任务
+type jobHandler struct {
+	ui        *downloadUI
+	name      string // 状态栏中显示的视频（分P）
+	autoSaved bool   // 已按模板保存到输出目录，无需再手动保存
+	result    *downloader.Result
 }
-func (ui *downloadUI) SetAudioProgress(p float64) {
-	ui.audioProgress.SetValue(p)
+
+func (ui *downloadUI) newJobHandler(ref utils.VideoRef, opts downloader.Options) *jobHandler {
+	name := ref.Key()
+	if opts.Page > 1 {
+		name += fmt.Sprintf(" P%d", opts.Page)
+	}
+	return &jobHandler{ui: ui, name: name, autoSaved: opts.OutputDir != ""}
+}
+
+// shown 该任务是否为进度条当前显示的任务
+func (h *jobHandler) shown() bool {
+	return h.ui.current.Load() == h
+}
+
+// OnStateChange 任务开始下载时接管进度条；未显示的任务失败时在状态栏提示
+func (h *jobHandler) OnStateChange(job *queue.Job) {
+	switch job.State() {
+	case queue.Running:
+		h.ui.current.Store(h)
+		fyne.Do(func() {
+			h.ui.coverPreview.Hide()
+			h.ui.videoDetail.SetText("")
+			h.ui.audioDetail.SetText("")
+		})
+	case queue.Failed:
+		if !h.shown() {
+			err := job.Err()
+			fyne.Do(func() { h.ui.statusLabel.SetText(fmt.Sprintf("%s 下载失败: %v", h.name, err)) })
+		}
+	}
 }
-func (ui *downloadUI) SetOverallProgress(p float64) {
-	ui.overallProgress.SetValue(p)
+
+// 以下回调在下载协程中调用，界面更新都切换到主线程
+func (h *jobHandler) SetVideoProgress(p float64) {
+	if h.shown() {
+		fyne.Do(func() { h.ui.videoProgress.SetValue(p) })
+	}
 }
+func (h *jobHandler) SetAudioProgress(p float64) {
+	if h.shown() {
+		fyne.Do(func() { h.ui.audioProgress.SetValue(p) })
+	}
+}
+func (h *jobHandler) SetOverallProgress(p float64) {
+	if h.shown() {
+		fyne.Do(func() { h.ui.overallProgress.SetValue(p) })
+	}
+}
+func (h *jobHandler) SetStatus(text string) {
+	if h.shown() {
+		fyne.Do(func() { h.ui.SetStatus(text) })
+	}
+}
+
+// OnProgress 在进度条下方显示已下载大小、速度和剩余时间
+func (h *jobHandler) OnProgress(p downloader.Progress) {
+	if !h.shown() {
+		return
+	}
+	label := h.ui.videoDetail
+	if p.Stream == downloader.StreamAudio {
+		label = h.ui.audioDetail
+	}
+	text := p.Summary()
+	fyne.Do(func() { label.SetText(text) })
+}
+
+// SetStatus 在主线程中调用，更新状态栏并发送通知
 func (ui *downloadUI) SetStatus(text string) {
-	// 切换到主线程更新 UI
 	fyne.CurrentApp().SendNotification(&fyne.Notification{Title: "状态更新", Content: text})
 	ui.statusLabel.SetText(text)
 }
-func (ui *downloadUI) OnDownloadComplete(outputPath, title string) {
-	ui.title = title
-	ui.saveBtn.OnTapped = func() {
-		safeTitle := sanitizeFileName(title)
-		defaultName := fmt.Sprintf("%s.mp4", safeTitle)
-		sd := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
-			if err != nil {
-				dialog.ShowError(err, ui.window)
-				return
-			}
-			if writer == nil {
-				return
-			}
-			in, err := os.Open(outputPath)
-			if err != nil {
-				dialog.ShowError(fmt.Errorf("无法打开临时文件: %w", err), ui.window)
-				return
-			}
-			defer in.Close()
-			if _, err := io.Copy(writer, in); err != nil {
-				dialog.ShowError(fmt.Errorf("保存失败: %w", err), ui.window)
-				return
-			}
-			// 清理 temp
-			os.Remove(outputPath)
-			dialog.ShowInformation("保存成功", "视频已保存", ui.window)
-		}, ui.window)
-		sd.SetFileName(defaultName)
-		sd.Show()
-	}
-	ui.saveBtn.Show()
-}
-
-func sanitizeFileName(name string) string {
-	replacer := []struct{ old, new string }{
-		{"/", "_"},
-		{"\\", "_"},
-		{":", "_"},
-		{"*", "_"},
-		{"?", "_"},
-		{"\"", "_"},
-		{"<", "_"},
-		{">", "_"},
-		{"|", "_"},
-	}
-	for _, r := range replacer {
-		name = strings.ReplaceAll(name, r.old, r.new)
-	}
-	return name
-}
-
-// Run 启动 GUI
-func Run() {
-	a := app.New()
+
+// OnCover 显示下载器已保存到临时目录的封面，不再单独下载。
+// 文件在下载结束后删除，因此立即读入内存
+func (h *jobHandler) OnCover(path string) {
+	if !h.shown() {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	res := fyne.NewStaticResource(filepath.Base(path), data)
+	fyne.Do(func() {
+		h.ui.coverPreview.Resource = res
+		h.ui.coverPreview.Show()
+		h.ui.coverPreview.Refresh()
+	})
+}
+
+// OnDownloadResult 记录下载结果；手动保存的文件在保存后才写入媒体库
+func (h *jobHandler) OnDownloadResult(res *downloader.Result) {
+	h.result = res
+	if h.autoSaved {
+		h.ui.recordResult(*res)
+	}
+}
+
+// OnDownloadComplete 未设置输出目录时，为该任务（互动视频的每个节点）添加一行保存按钮
+func (h *jobHandler) OnDownloadComplete(outputPath, title string) {
+	ui := h.ui
+	if h.autoSaved {
+		if h.shown() {
+			fyne.Do(func() { ui.statusLabel.SetText(fmt.Sprintf("已保存到 %s", outputPath)) })
+		}
+		return
+	}
+	// OnDownloadResult 在同一协程中先于本回调调用，此时的结果属于这个文件
+	res := h.result
+	fyne.Do(func() { ui.addSaveRow(outputPath, title, res) })
+}
+
+// addSaveRow 添加一个已下载到临时目录的文件，保存后移除该行
+func (ui *downloadUI) addSaveRow(outputPath, title string, res *downloader.Result) {
+	var row *fyne.Container
+	btn := widget.NewButton("保存文件", func() {
+		ui.saveFile(outputPath, title, res, func() { ui.saveList.Remove(row) })
+	})
+	row = container.NewBorder(nil, nil, nil, btn, widget.NewLabel(title))
+	ui.saveList.Add(row)
+}
+
+// saveFile 让用户选择保存位置，将临时文件复制过去后删除，并写入媒体库
+func (ui *downloadUI) saveFile(outputPath, title string, res *downloader.Result, saved func()) {
+	sd := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		in, err := os.Open(outputPath)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("无法打开临时文件: %w", err), ui.window)
+			return
+		}
+		defer in.Close()
+		if _, err := io.Copy(writer, in); err != nil {
+			dialog.ShowError(fmt.Errorf("保存失败: %w", err), ui.window)
+			return
+		}
+		// 清理 temp
+		os.Remove(outputPath)
+		if res != nil {
+			r := *res
+			r.Path = writer.URI().Path()
+			ui.recordResult(r)
+		}
+		saved()
+		dialog.ShowInformation("保存成功", "视频已保存", ui.window)
+	}, ui.window)
+	sd.SetFileName(utils.SanitizeFileName(title) + filepath.Ext(outputPath))
+	sd.Show()
+}
+
+// startDownload 检查是否下载过后将视频加入队列，音频歌单按批量导入展开为单曲
+func (ui *downloadUI) startDownload(ref utils.VideoRef) {
+	if ref.Kind == utils.KindMenu {
+		ui.importBatch([]batch.Item{{Input: ref.URL()}})
+		return
+	}
+	ui.enqueue(ref)
+}
+
+// enqueue 确认重复下载后将单个视频（分P）加入队列，进度显示在主界面
+func (ui *downloadUI) enqueue(ref utils.VideoRef) {
+	ui.confirmDuplicate(ref.Key(), ref.Page, func() {
+		status := "已加入下载队列"
+		if ref.Start > 0 {
+			sec := int(ref.Start.Seconds())
+			status += fmt.Sprintf("，链接中的时间点为 %d:%02d", sec/60, sec%60)
+		}
+		ui.SetStatus(status)
+		opts := ui.settings.DownloadOptions()
+		opts.Page = ref.Page
+		// 交给队列在后台执行，不在下载时段内时会排队等待
+		ui.queue.Add(ref.Kind, ref.ID, opts, ui.newJobHandler(ref, opts))
+	})
+}
+
+// handoff 处理浏览器通过 dilidili:// 链接转交的视频：填入输入框并加入队列，
+// 链接中的分P和时间点保留在输入框的链接中
+func (ui *downloadUI) handoff(link string) {
+	ref, err := instance.ParseSchemeURL(link)
+	if err != nil {
+		dialog.ShowError(err, ui.window)
+		return
+	}
+	ui.entry.SetText(ref.URL())
+	ui.window.RequestFocus()
+	ui.startDownload(ref)
+}
+
+// Run 启动 GUI，links 为启动时收到的 dilidili:// 链接
+func Run(links ...string) {
+	a := app.NewWithID("com.dilidili.app")
 	a.SetIcon(resourceLogoPng)
 	w := a.NewWindow("B站视频下载器")
 
+	// 后台的评论导出在窗口关闭时取消
+	exportCtx, stopExports := context.WithCancel(context.Background())
+	downloader.SetExportContext(exportCtx)
+
 	ui := &downloadUI{
 		window:          w,
 		entry:           widget.NewEntry(),
@@ -108,29 +272,67 @@ func Run() {
 		videoProgress:   widget.NewProgressBar(),
 		audioProgress:   widget.NewProgressBar(),
 		overallProgress: widget.NewProgressBar(),
+		videoDetail:     widget.NewLabel(""),
+		audioDetail:     widget.NewLabel(""),
+		prefs:           a.Preferences(),
+	}
+	ui.stored = loadSettings(ui.prefs)
+	if err := ui.stored.Validate(); err != nil {
+		fyne.LogError("设置无效，已恢复默认值", err)
+		ui.stored = config.Default()
+	}
+	ui.settings = withEnv(ui.stored)
+	if err := ui.settings.Validate(); err != nil {
+		fyne.LogError("环境变量中的设置无效，已忽略", err)
+		ui.settings = ui.stored
+	}
+	if err := ui.settings.Apply(); err != nil {
+		fyne.LogError("应用设置失败", err)
+	}
+	if lib, err := library.Open(library.DefaultPath()); err != nil {
+		fyne.LogError("打开媒体库失败", err)
+	} else {
+		ui.lib = lib
 	}
 	ui.entry.SetPlaceHolder("输入 B 站 BV 号或视频链接")
 
-	ui.saveBtn = widget.NewButton("保存文件", nil)
-	ui.saveBtn.Hide()
+	// 同时下载的任务数来自设置，修改后重启生效
+	ui.queue = queue.New(ui.settings.Concurrency)
+	ui.queue.SetSchedule(ui.settings.ParsedSchedule())
+	ui.rateSelect = ui.newRateSelect()
+
+	ui.coverPreview = canvas.NewImageFromResource(nil)
+	ui.coverPreview.FillMode = canvas.ImageFillContain
+	ui.coverPreview.SetMinSize(fyne.NewSize(240, 135))
+	ui.coverPreview.Hide()
+
+	ui.saveList = container.NewVBox()
 
 	downloadBtn := widget.NewButton("开始下载", func() {
-		bvid := utils.ExtractBVID(ui.entry.Text)
-		if bvid == "" {
+		text := ui.entry.Text
+		if ref, ok := utils.ParseVideoRef(text); ok {
+			ui.startDownload(ref)
+			return
+		}
+		if !utils.IsShortLink(text) {
 			dialog.ShowError(fmt.Errorf("请输入正确的BV号或链接"), w)
 			return
 		}
-		ui.bvid = bvid
-		ui.SetStatus("开始下载...")
-		ui.saveBtn.Hide()
-		// 在后台执行下载
+		// b23.tv 短链接需要先请求得到视频页地址
 		go func() {
-			if err := downloader.DownloadAndMerge(bvid, ui); err != nil {
-				ui.SetStatus(fmt.Sprintf("错误: %v", err))
-			}
+			ref, err := api.ResolveVideoRef(text)
+			fyne.Do(func() {
+				if err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+				ui.startDownload(ref)
+			})
 		}()
 	})
 	ui.downloadBtn = downloadBtn
+	settingsBtn := widget.NewButton("设置", ui.showSettingsDialog)
+	batchBtn := widget.NewButton("批量导入", ui.showBatchImport)
 
 	// 创建logo图像
 	logoImg := canvas.NewImageFromResource(resourceLogoPng)
@@ -143,18 +345,49 @@ func Run() {
 		widget.NewLabel("Dilidili - B站视频下载器"),
 	)
 
+	ui.clipboard = newClipboardWatcher(ui)
+
 	content := container.NewVBox(
 		titleContainer,
 		widget.NewSeparator(),
+		ui.clipboard.bar,
 		ui.entry,
-		downloadBtn,
+		container.NewGridWithColumns(3, downloadBtn, batchBtn, settingsBtn),
+		container.NewBorder(nil, nil, widget.NewLabel("限速:"), nil, ui.rateSelect),
+		ui.coverPreview,
 		ui.statusLabel,
-		widget.NewLabel("视频进度:"), ui.videoProgress,
-		widget.NewLabel("音频进度:"), ui.audioProgress,
+		widget.NewLabel("视频进度:"), ui.videoProgress, ui.videoDetail,
+		widget.NewLabel("音频进度:"), ui.audioProgress, ui.audioDetail,
 		widget.NewLabel("总体进度:"), ui.overallProgress,
-		ui.saveBtn,
+		ui.saveList,
+	)
+	tabs := container.NewAppTabs(
+		container.NewTabItem("下载", content),
+		container.NewTabItem("历史", ui.newHistoryTab()),
+		container.NewTabItem("直播", ui.newLiveTab()),
 	)
-	w.SetContent(content)
-	w.Resize(fyne.NewSize(600, 500))
+	w.SetContent(tabs)
+	w.Resize(fyne.NewSize(600, 700))
+
+	// 作为唯一实例接收后续启动的进程转交的链接
+	if ln, err := instance.Listen(func(link string) {
+		fyne.Do(func() { ui.handoff(link) })
+	}); err != nil {
+		fyne.LogError("无法接收其他进程转交的链接", err)
+	} else {
+		defer ln.Close()
+	}
+	// macOS 通过 Apple Event 传递链接
+	instance.HandleURLEvents(func(link string) {
+		fyne.Do(func() { ui.handoff(link) })
+	})
+	for _, link := range links {
+		ui.handoff(link)
+	}
+	ui.clipboard.apply()
 	w.ShowAndRun()
+	// 窗口关闭后结束正在进行的直播录制，转封装完成后再退出
+	ui.live.shutdown()
+	stopExports()
+	downloader.WaitCommentExports()
 }
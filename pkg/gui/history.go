@@ -0,0 +1,101 @@
+package gui
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/library"
+)
+
+// recordResult 将结果写入媒体库并刷新历史列表
+func (ui *downloadUI) recordResult(res downloader.Result) {
+	if ui.lib == nil {
+		return
+	}
+	if err := ui.lib.Add(library.EntryFromResult(&res)); err != nil {
+		fyne.LogError("写入媒体库失败", err)
+		return
+	}
+	fyne.Do(ui.refreshHistory)
+}
+
+// confirmDuplicate 媒体库中已有该视频（分P）且文件仍存在时先询问用户，确认后调用 start
+func (ui *downloadUI) confirmDuplicate(bvid string, page int, start func()) {
+	if page < 1 {
+		page = 1
+	}
+	if ui.lib != nil {
+		for _, e := range ui.lib.Find(bvid, page) {
+			if !e.Exists() {
+				continue
+			}
+			msg := fmt.Sprintf("%s 已于 %s 下载到:\n%s\n\n是否重新下载？",
+				e.Title, e.DownloadedAt.Format("2006-01-02 15:04"), e.Path)
+			dialog.ShowConfirm("已下载过", msg, func(ok bool) {
+				if ok {
+					start()
+				}
+			}, ui.window)
+			return
+		}
+	}
+	start()
+}
+
+// newHistoryTab 创建下载历史页：搜索框 + 记录列表
+func (ui *downloadUI) newHistoryTab() fyne.CanvasObject {
+	search := widget.NewEntry()
+	search.SetPlaceHolder("搜索标题、UP 主、BV 号或路径")
+
+	list := widget.NewList(
+		func() int { return len(ui.historyEntries) },
+		func() fyne.CanvasObject {
+			title := widget.NewLabel("")
+			title.Truncation = fyne.TextTruncateEllipsis
+			detail := widget.NewLabel("")
+			detail.Truncation = fyne.TextTruncateEllipsis
+			open := widget.NewButton("打开文件夹", nil)
+			return container.NewBorder(nil, nil, nil, open, container.NewVBox(title, detail))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			e := ui.historyEntries[id]
+			row := obj.(*fyne.Container)
+			labels := row.Objects[0].(*fyne.Container)
+			labels.Objects[0].(*widget.Label).SetText(e.Title)
+			status := ""
+			if !e.Exists() {
+				status = "（文件已不存在）"
+			}
+			labels.Objects[1].(*widget.Label).SetText(fmt.Sprintf("%s  P%d  %s  %.1f MB  %s%s",
+				e.BVID, e.Page, e.DownloadedAt.Format("2006-01-02 15:04"),
+				float64(e.Size)/(1<<20), e.Path, status))
+			row.Objects[1].(*widget.Button).OnTapped = func() { ui.openFolder(e.Path) }
+		},
+	)
+
+	ui.refreshHistory = func() {
+		if ui.lib != nil {
+			ui.historyEntries = ui.lib.Search(search.Text)
+		}
+		list.Refresh()
+	}
+	search.OnChanged = func(string) { ui.refreshHistory() }
+	ui.refreshHistory()
+
+	return container.NewBorder(search, nil, nil, nil, list)
+}
+
+// openFolder 在系统文件管理器中打开文件所在目录
+func (ui *downloadUI) openFolder(path string) {
+	u := &url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Dir(path))}
+	if err := fyne.CurrentApp().OpenURL(u); err != nil {
+		dialog.ShowError(err, ui.window)
+	}
+}
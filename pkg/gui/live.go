@@ -0,0 +1,180 @@
+package gui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"dilidili/pkg/config"
+	"dilidili/pkg/live"
+	"dilidili/pkg/utils"
+)
+
+// liveTab 直播页：监视的直播间列表和各自的录制状态
+type liveTab struct {
+	ui      *downloadUI
+	monitor *live.Monitor
+	rooms   []live.RoomStatus
+	list    *widget.List
+	stop    context.CancelFunc
+	done    chan struct{}
+	closing atomic.Bool // 窗口已关闭，不再刷新界面
+}
+
+// liveOptions 直播录制使用界面设置中的输出目录，未设置时使用默认目录
+func (ui *downloadUI) liveOptions() live.Options {
+	dir := ui.settings.OutputDir
+	if dir == "" {
+		dir = config.DefaultOutputDir()
+	}
+	return live.Options{OutputDir: dir, Remux: true, Danmaku: true}
+}
+
+// newLiveTab 创建直播页并在后台开始监视
+func (ui *downloadUI) newLiveTab() fyne.CanvasObject {
+	t := &liveTab{ui: ui, done: make(chan struct{})}
+	ui.live = t
+	t.monitor = live.NewMonitor(ui.settings.ParsedLiveRooms(), 0, ui.liveOptions(), t)
+	t.rooms = t.monitor.Rooms()
+
+	t.list = widget.NewList(
+		func() int { return len(t.rooms) },
+		func() fyne.CanvasObject {
+			name := widget.NewLabel("")
+			name.TextStyle.Bold = true
+			detail := widget.NewLabel("")
+			detail.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, nil,
+				container.NewHBox(widget.NewButton("打开文件夹", nil), widget.NewButton("移除", nil)),
+				container.NewVBox(name, detail))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			s := t.rooms[id]
+			row := obj.(*fyne.Container)
+			labels := row.Objects[0].(*fyne.Container)
+			buttons := row.Objects[1].(*fyne.Container)
+			labels.Objects[0].(*widget.Label).SetText(roomName(s) + " · " + s.State.String())
+			labels.Objects[1].(*widget.Label).SetText(roomDetail(s))
+			open := buttons.Objects[0].(*widget.Button)
+			if len(s.Files) == 0 {
+				open.Disable()
+			} else {
+				open.OnTapped = func() { t.ui.openFolder(s.Files[len(s.Files)-1]) }
+				open.Enable()
+			}
+			buttons.Objects[1].(*widget.Button).OnTapped = func() { t.remove(s.RoomID) }
+		},
+	)
+
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("房间号或直播间链接")
+	add := func() {
+		id, ok := utils.ParseLiveRoom(entry.Text)
+		if !ok {
+			dialog.ShowError(fmt.Errorf("请输入正确的房间号或直播间链接"), ui.window)
+			return
+		}
+		entry.SetText("")
+		t.setRooms(append(ui.settings.ParsedLiveRooms(), id))
+	}
+	entry.OnSubmitted = func(string) { add() }
+	addBtn := widget.NewButton("添加", add)
+	checkBtn := widget.NewButton("立即检查", t.monitor.CheckNow)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.stop = cancel
+	go func() {
+		defer close(t.done)
+		t.monitor.Run(ctx)
+	}()
+
+	top := container.NewVBox(
+		widget.NewLabel("开播后自动录制，下播后结束并转封装为 MP4"),
+		container.NewBorder(nil, nil, nil, container.NewHBox(addBtn, checkBtn), entry),
+	)
+	return container.NewBorder(top, nil, nil, nil, t.list)
+}
+
+// OnRoomUpdate 刷新列表中对应的直播间
+func (t *liveTab) OnRoomUpdate(live.RoomStatus) {
+	if t.closing.Load() {
+		return
+	}
+	rooms := t.monitor.Rooms()
+	fyne.Do(func() {
+		t.rooms = rooms
+		t.list.Refresh()
+	})
+}
+
+// setRooms 保存直播间列表并通知监视器
+func (t *liveTab) setRooms(ids []int64) {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatInt(id, 10)
+	}
+	stored := t.ui.stored
+	stored.LiveRooms = strings.Join(strs, ",")
+	t.ui.storeSettings(stored)
+	t.monitor.SetRooms(stored.ParsedLiveRooms())
+	t.rooms = t.monitor.Rooms()
+	t.list.Refresh()
+}
+
+// remove 移除直播间，正在录制时先确认
+func (t *liveTab) remove(roomID int64) {
+	var ids []int64
+	recording := false
+	for _, s := range t.rooms {
+		if s.RoomID != roomID {
+			ids = append(ids, s.RoomID)
+		} else {
+			recording = s.State == live.RoomRecording
+		}
+	}
+	if !recording {
+		t.setRooms(ids)
+		return
+	}
+	dialog.ShowConfirm("移除直播间", "该直播间正在录制，移除后将停止录制并保存已录制的部分。是否继续？", func(ok bool) {
+		if ok {
+			t.setRooms(ids)
+		}
+	}, t.ui.window)
+}
+
+// shutdown 停止监视，等待正在进行的录制收尾和转封装
+func (t *liveTab) shutdown() {
+	t.closing.Store(true)
+	t.stop()
+	<-t.done
+}
+
+func roomName(s live.RoomStatus) string {
+	if s.Uname == "" {
+		return fmt.Sprintf("直播间 %d", s.RoomID)
+	}
+	return fmt.Sprintf("%s (%d)", s.Uname, s.RoomID)
+}
+
+func roomDetail(s live.RoomStatus) string {
+	switch {
+	case s.Err != nil:
+		return s.Err.Error()
+	case s.State == live.RoomRecording:
+		return fmt.Sprintf("%s · 自 %s 开始 · %s", s.Title, s.Since.Format("15:04"), s.Status)
+	case len(s.Files) > 0:
+		return fmt.Sprintf("已录制 %d 个文件，最近: %s", len(s.Files), filepath.Base(s.Files[len(s.Files)-1]))
+	case !s.Checked.IsZero():
+		return "上次检查: " + s.Checked.Format("15:04:05")
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+// Package instance 保证图形界面只运行一个实例：后启动的进程（如浏览器通过 dilidili:// 链接启动的）
+// 通过本地套接字把参数转交给已运行的实例后退出
+package instance
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// socketPath 本机唯一的监听地址，位于用户缓存目录下
+func socketPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "dilidili", "instance.sock")
+}
+
+// Send 将参数交给已在运行的实例，每个参数一行。没有运行中的实例时返回错误
+func Send(args []string) error {
+	conn, err := net.DialTimeout("unix", socketPath(), 2*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	w := bufio.NewWriter(conn)
+	for _, a := range args {
+		fmt.Fprintln(w, strings.ReplaceAll(a, "\n", ""))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if uc, ok := conn.(*net.UnixConn); ok {
+		uc.CloseWrite()
+	}
+	// 等待对方确认收到
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	return err
+}
+
+// Listen 声明当前进程为唯一实例，之后其他进程 Send 的参数会逐个传给 handle。
+// 已有实例在运行时返回错误
+func Listen(handle func(arg string)) (net.Listener, error) {
+	path := socketPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		// 上次异常退出会留下套接字文件：连不上说明没有实例在运行，删除后重试
+		if conn, dialErr := net.DialTimeout("unix", path, time.Second); dialErr == nil {
+			conn.Close()
+			return nil, errors.New("已有实例在运行")
+		}
+		os.Remove(path)
+		if ln, err = net.Listen("unix", path); err != nil {
+			return nil, err
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, handle)
+		}
+	}()
+	return ln, nil
+}
+
+func serve(conn net.Conn, handle func(string)) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	scanner := bufio.NewScanner(conn)
+	var args []string
+	for scanner.Scan() {
+		args = append(args, scanner.Text())
+	}
+	fmt.Fprintln(conn, "ok")
+	for _, a := range args {
+		handle(a)
+	}
+}
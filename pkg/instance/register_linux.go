@@ -0,0 +1,44 @@
+package instance
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// RegisterScheme 为当前用户注册 dilidili:// 协议，由当前可执行文件处理
+func RegisterScheme() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dir := filepath.Join(dataHome, "applications")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	const name = "dilidili-url-handler.desktop"
+	desktop := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=Dilidili
+Exec=%q %%u
+NoDisplay=true
+MimeType=x-scheme-handler/%s;
+`, exe, Scheme)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(desktop), 0644); err != nil {
+		return err
+	}
+	out, err := exec.Command("xdg-mime", "default", name, "x-scheme-handler/"+Scheme).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("xdg-mime 失败: %v %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+
+package instance
+
+import "errors"
+
+// RegisterScheme macOS 上协议由应用包 Info.plist 中的 CFBundleURLTypes 声明，无需运行时注册
+func RegisterScheme() error {
+	return errors.New("当前系统通过应用包的 Info.plist 注册 dilidili:// 协议")
+}
@@ -0,0 +1,27 @@
+package instance
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// RegisterScheme 在 HKEY_CURRENT_USER 下注册 dilidili:// 协议，由当前可执行文件处理
+func RegisterScheme() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	key := `HKCU\Software\Classes\` + Scheme
+	cmds := [][]string{
+		{"add", key, "/ve", "/d", "URL:Dilidili", "/f"},
+		{"add", key, "/v", "URL Protocol", "/d", "", "/f"},
+		{"add", key + `\shell\open\command`, "/ve", "/d", fmt.Sprintf(`"%s" "%%1"`, exe), "/f"},
+	}
+	for _, args := range cmds {
+		if out, err := exec.Command("reg", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("写入注册表失败: %v %s", err, out)
+		}
+	}
+	return nil
+}
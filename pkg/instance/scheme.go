@@ -0,0 +1,37 @@
+package instance
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"dilidili/pkg/utils"
+)
+
+// Scheme 注册到系统的 URL 协议名
+const Scheme = "dilidili"
+
+// IsSchemeURL 判断参数是否为 dilidili:// 链接
+func IsSchemeURL(s string) bool {
+	return strings.HasPrefix(strings.ToLower(s), Scheme+":")
+}
+
+// ParseSchemeURL 解析 dilidili:// 链接，支持两种形式：
+//
+//	dilidili://download?url=<经过编码的视频页链接>   （书签脚本使用）
+//	dilidili://BV1xx411c7mD?p=2&t=30
+func ParseSchemeURL(s string) (utils.VideoRef, error) {
+	u, err := url.Parse(s)
+	if err != nil || !strings.EqualFold(u.Scheme, Scheme) {
+		return utils.VideoRef{}, fmt.Errorf("不是 %s:// 链接: %q", Scheme, s)
+	}
+	target := s
+	if inner := u.Query().Get("url"); inner != "" {
+		target = inner
+	}
+	ref, ok := utils.ParseVideoRef(target)
+	if !ok {
+		return utils.VideoRef{}, fmt.Errorf("链接中没有可识别的视频: %q", s)
+	}
+	return ref, nil
+}
@@ -0,0 +1,46 @@
+package instance
+
+import (
+	"testing"
+	"time"
+
+	"dilidili/pkg/utils"
+)
+
+func TestParseSchemeURL(t *testing.T) {
+	tests := []struct {
+		link string
+		want utils.VideoRef
+	}{
+		{"dilidili://BV17x411w7KC", utils.VideoRef{ID: "BV17x411w7KC"}},
+		{"dilidili://BV17x411w7KC?p=2&t=30", utils.VideoRef{ID: "BV17x411w7KC", Page: 2, Start: 30 * time.Second}},
+		{"DILIDILI://av170001", utils.VideoRef{ID: "BV17x411w7KC"}},
+		{
+			"dilidili://download?url=https%3A%2F%2Fwww.bilibili.com%2Fvideo%2FBV17x411w7KC%2F%3Fp%3D3%26t%3D75.5",
+			utils.VideoRef{ID: "BV17x411w7KC", Page: 3, Start: 75500 * time.Millisecond},
+		},
+		{
+			"dilidili://download?url=https%3A%2F%2Fwww.bilibili.com%2Fcheese%2Fplay%2Fep1234",
+			utils.VideoRef{Kind: utils.KindCheese, ID: "1234"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseSchemeURL(tt.link)
+		if err != nil {
+			t.Errorf("ParseSchemeURL(%q) error: %v", tt.link, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSchemeURL(%q) = %+v, want %+v", tt.link, got, tt.want)
+		}
+	}
+	for _, link := range []string{
+		"https://www.bilibili.com/video/BV17x411w7KC",
+		"dilidili://download?url=https%3A%2F%2Fexample.com%2F",
+		"dilidili://",
+	} {
+		if got, err := ParseSchemeURL(link); err == nil {
+			t.Errorf("ParseSchemeURL(%q) = %+v, want error", link, got)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+//go:build darwin && cgo
+
+package instance
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Foundation
+void dilidiliRegisterURLHandler(void);
+*/
+import "C"
+
+import "sync"
+
+var (
+	urlMu       sync.Mutex
+	urlHandle   func(link string)
+	urlRegister sync.Once
+)
+
+// HandleURLEvents 接收系统打开 dilidili:// 链接的 Apple Event 并交给 handle。
+// macOS 不通过命令行参数传递链接，无论应用是刚被链接启动还是已在运行，都只会收到该事件。
+// 需要在应用的事件循环开始前调用，handle 在主线程中执行
+func HandleURLEvents(handle func(link string)) {
+	urlMu.Lock()
+	urlHandle = handle
+	urlMu.Unlock()
+	urlRegister.Do(func() { C.dilidiliRegisterURLHandler() })
+}
+
+//export dilidiliHandleURL
+func dilidiliHandleURL(url *C.char) {
+	link := C.GoString(url)
+	urlMu.Lock()
+	handle := urlHandle
+	urlMu.Unlock()
+	if handle != nil && IsSchemeURL(link) {
+		handle(link)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build darwin && cgo
+
+#import <Foundation/Foundation.h>
+
+extern void dilidiliHandleURL(char *url);
+
+// DilidiliURLHandler 处理 kAEGetURL 事件，即打开已注册协议的链接
+@interface DilidiliURLHandler : NSObject
+- (void)handleGetURL:(NSAppleEventDescriptor *)event withReplyEvent:(NSAppleEventDescriptor *)reply;
+@end
+
+@implementation DilidiliURLHandler
+- (void)handleGetURL:(NSAppleEventDescriptor *)event withReplyEvent:(NSAppleEventDescriptor *)reply {
+	NSString *url = [[event paramDescriptorForKeyword:keyDirectObject] stringValue];
+	if (url != nil) {
+		dilidiliHandleURL((char *)[url UTF8String]);
+	}
+}
+@end
+
+void dilidiliRegisterURLHandler(void) {
+	static DilidiliURLHandler *handler;
+	handler = [[DilidiliURLHandler alloc] init];
+	[[NSAppleEventManager sharedAppleEventManager] setEventHandler:handler
+	                                                   andSelector:@selector(handleGetURL:withReplyEvent:)
+	                                                 forEventClass:kInternetEventClass
+	                                                    andEventID:kAEGetURL];
+}
@@ -0,0 +1,6 @@
+//go:build !darwin || !cgo
+
+package instance
+
+// HandleURLEvents 其他系统通过命令行参数传递 dilidili:// 链接，无需处理系统事件
+func HandleURLEvents(handle func(link string)) {}
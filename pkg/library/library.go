@@ -0,0 +1,232 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dilidili/pkg/downloader"
+)
+
+// Entry 媒体库中的一条下载记录
+type Entry struct {
+	BVID         string    `json:"bvid"`
+	Cid          int       `json:"cid"`
+	Page         int       `json:"page"`
+	Title        string    `json:"title"`
+	Uploader     string    `json:"uploader,omitempty"`
+	Quality      int       `json:"quality"`
+	VideoCodec   string    `json:"video_codec,omitempty"`
+	AudioCodec   string    `json:"audio_codec,omitempty"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256,omitempty"`
+	PublishedAt  time.Time `json:"published_at"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// Exists 记录对应的文件是否仍在磁盘上
+func (e Entry) Exists() bool {
+	_, err := os.Stat(e.Path)
+	return err == nil
+}
+
+// Library 保存在单个 JSON 文件中的本地媒体库，可并发使用。
+// 界面、命令行和本地服务可能同时打开同一个媒体库，写入时持有文件锁并先重新读取，
+// 不会覆盖其他进程刚添加的记录
+type Library struct {
+	mu      sync.Mutex
+	path    string
+	entries []Entry
+	modTime time.Time // 上次读取时文件的修改时间
+	size    int64
+}
+
+// DefaultPath 返回媒体库文件的默认位置
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "library.json"
+	}
+	return filepath.Join(dir, "dilidili", "library.json")
+}
+
+// Open 打开媒体库，文件不存在时返回空库
+func Open(path string) (*Library, error) {
+	lib := &Library{path: path}
+	if err := lib.reload(); err != nil {
+		return nil, err
+	}
+	return lib, nil
+}
+
+// reload 文件自上次读取后有变化时重新读取，文件不存在时视为空库
+func (l *Library) reload() error {
+	fi, err := os.Stat(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		l.entries, l.modTime, l.size = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(l.modTime) && fi.Size() == l.size {
+		return nil
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	l.entries, l.modTime, l.size = entries, fi.ModTime(), fi.Size()
+	return nil
+}
+
+// lock 取得媒体库文件旁 .lock 文件的独占锁，返回解锁函数
+func (l *Library) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(l.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// Add 添加一条记录并立即写盘；同一路径的旧记录会被替换
+func (l *Library) Add(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := l.reload(); err != nil {
+		return err
+	}
+	if e.DownloadedAt.IsZero() {
+		e.DownloadedAt = time.Now()
+	}
+	kept := l.entries[:0]
+	for _, old := range l.entries {
+		if old.Path != e.Path {
+			kept = append(kept, old)
+		}
+	}
+	l.entries = append(kept, e)
+	return l.save()
+}
+
+// Find 返回同一视频的已有记录，page 为 0 时匹配所有分 P
+func (l *Library) Find(bvid string, page int) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reload() // 读取其他进程写入的记录，失败时沿用内存中的记录
+	var found []Entry
+	for _, e := range l.entries {
+		if e.BVID == bvid && (page == 0 || e.Page == page) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Search 按标题、UP 主、BV 号或路径搜索记录，结果按下载时间倒序排列；
+// query 为空时返回全部记录
+func (l *Library) Search(query string) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reload() // 读取其他进程写入的记录，失败时沿用内存中的记录
+	query = strings.ToLower(strings.TrimSpace(query))
+	var found []Entry
+	for _, e := range l.entries {
+		if query == "" ||
+			strings.Contains(strings.ToLower(e.Title), query) ||
+			strings.Contains(strings.ToLower(e.Uploader), query) ||
+			strings.Contains(strings.ToLower(e.BVID), query) ||
+			strings.Contains(strings.ToLower(e.Path), query) {
+			found = append(found, e)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].DownloadedAt.After(found[j].DownloadedAt)
+	})
+	return found
+}
+
+// save 在同一目录写入临时文件并同步到磁盘后再重命名覆盖，写到一半或断电时
+// 媒体库仍是完整的旧版本或新版本
+func (l *Library) save() (err error) {
+	dir := filepath.Dir(l.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(l.path); err == nil {
+		l.modTime, l.size = fi.ModTime(), fi.Size()
+	}
+	return nil
+}
+
+// EntryFromResult 将下载结果转换为媒体库记录
+func EntryFromResult(r *downloader.Result) Entry {
+	return Entry{
+		BVID:        r.BVID,
+		Cid:         r.Cid,
+		Page:        r.Page,
+		Title:       r.Title,
+		Uploader:    r.Uploader,
+		Quality:     r.Quality,
+		VideoCodec:  r.VideoCodec,
+		AudioCodec:  r.AudioCodec,
+		Path:        r.Path,
+		Size:        r.Size,
+		SHA256:      r.SHA256,
+		PublishedAt: r.PublishedAt,
+	}
+}
@@ -0,0 +1,66 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLibraryAdd(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.json")
+	a, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一个媒体库文件被另一个进程打开
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		lib *Library
+		e   Entry
+	}{
+		{a, Entry{BVID: "BV1", Page: 1, Title: "旧标题", Path: "/v/1.mp4", DownloadedAt: base}},
+		{b, Entry{BVID: "BV1", Page: 2, Title: "第二集", Path: "/v/2.mp4", DownloadedAt: base.Add(time.Hour)}},
+		{a, Entry{BVID: "BV1", Page: 1, Title: "新标题", Path: "/v/1.mp4", DownloadedAt: base.Add(2 * time.Hour)}},
+	}
+	for _, s := range steps {
+		if err := s.lib.Add(s.e); err != nil {
+			t.Fatalf("Add(%s) error: %v", s.e.Path, err)
+		}
+	}
+
+	for _, lib := range []*Library{a, b} {
+		got := lib.Search("")
+		if len(got) != 2 || got[0].Title != "新标题" || got[1].Title != "第二集" {
+			t.Errorf("Search(\"\") = %+v, want 新标题 then 第二集", got)
+		}
+		if got := lib.Find("BV1", 2); len(got) != 1 || got[0].Path != "/v/2.mp4" {
+			t.Errorf("Find(BV1, 2) = %+v", got)
+		}
+		if got := lib.Search("第二"); len(got) != 1 {
+			t.Errorf("Search(第二) = %+v, want one entry", got)
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if name := f.Name(); name != "library.json" && name != "library.json.lock" {
+			t.Errorf("leftover file %s", name)
+		}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0644 {
+		t.Errorf("library mode = %o, want 644", mode)
+	}
+}
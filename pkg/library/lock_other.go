@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package library
+
+import "os"
+
+// 不支持文件锁的平台上只有进程内的互斥
+func lockFile(f *os.File) error   { return nil }
+func unlockFile(f *os.File) error { return nil }
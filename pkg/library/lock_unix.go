@@ -0,0 +1,17 @@
+//go:build unix
+
+package library
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile 阻塞直到取得 f 的独占锁，进程退出时系统会自动释放
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,16 @@
+package library
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile 阻塞直到取得 f 的独占锁，进程退出时系统会自动释放
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
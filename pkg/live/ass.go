@@ -0,0 +1,204 @@
+package live
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ASS 字幕的画布和弹幕布局
+const (
+	assWidth       = 1920
+	assHeight      = 1080
+	assFontSize    = 50
+	assLineHeight  = 56
+	scrollDuration = 10 * time.Second // 滚动弹幕从右到左穿过画面的时间
+	fixedDuration  = 4 * time.Second  // 顶部、底部弹幕的停留时间
+	scDuration     = 8 * time.Second  // 醒目留言的停留时间
+)
+
+// danmakuWriter 将弹幕按录像分段写入 JSON Lines 文件，时间相对当前分段的开始
+type danmakuWriter struct {
+	mu    sync.Mutex
+	f     *os.File
+	enc   *json.Encoder
+	start time.Time
+	paths []string
+}
+
+// danmakuPath 返回录像文件对应的弹幕文件路径
+func danmakuPath(videoPath string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + ".danmaku.jsonl"
+}
+
+// rotate 结束上一个弹幕文件，为新的录像分段创建弹幕文件
+func (w *danmakuWriter) rotate(videoPath string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closeLocked()
+	f, err := os.Create(danmakuPath(videoPath))
+	if err != nil {
+		return err
+	}
+	w.f, w.enc, w.start = f, json.NewEncoder(f), time.Now()
+	w.paths = append(w.paths, f.Name())
+	return nil
+}
+
+func (w *danmakuWriter) write(ev DanmakuEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.enc == nil {
+		return // 第一个分段开始前的弹幕无处对齐，直接丢弃
+	}
+	ev.Time = time.Since(w.start).Seconds()
+	w.enc.Encode(ev)
+}
+
+func (w *danmakuWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closeLocked()
+}
+
+func (w *danmakuWriter) closeLocked() {
+	if w.f != nil {
+		w.f.Close()
+		w.f, w.enc = nil, nil
+	}
+}
+
+// ReadDanmakuFile 读取录制时保存的 JSON Lines 弹幕文件
+func ReadDanmakuFile(path string) ([]DanmakuEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []DanmakuEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var ev DanmakuEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("%s 第 %d 行: %w", path, line, err)
+		}
+		events = append(events, ev)
+	}
+	return events, scanner.Err()
+}
+
+// ConvertDanmakuFile 将弹幕文件转换为 ASS 字幕，播放录像时可作为弹幕层叠加
+func ConvertDanmakuFile(jsonlPath, assPath string) error {
+	events, err := ReadDanmakuFile(jsonlPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(assPath)
+	if err != nil {
+		return err
+	}
+	if err := WriteASS(f, events); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteASS 将弹幕和醒目留言写为 ASS 字幕：普通弹幕从右向左滚动，顶部、底部弹幕和醒目留言固定显示。
+// 礼物只保存在弹幕文件中，不进入字幕
+func WriteASS(w io.Writer, events []DanmakuEvent) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "[Script Info]\nScriptType: v4.00+\nPlayResX: %d\nPlayResY: %d\nWrapStyle: 2\nScaledBorderAndShadow: yes\n\n", assWidth, assHeight)
+	bw.WriteString("[V4+ Styles]\n")
+	bw.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	fmt.Fprintf(bw, "Style: Danmaku,sans-serif,%d,&H33FFFFFF,&H33FFFFFF,&H33000000,&H00000000,0,0,0,0,100,100,0,0,1,2,0,7,0,0,0,1\n", assFontSize)
+	fmt.Fprintf(bw, "Style: SuperChat,sans-serif,%d,&H0000D7FF,&H0000D7FF,&H00000000,&H80000000,1,0,0,0,100,100,0,0,3,2,0,8,0,0,0,1\n\n", assFontSize)
+	bw.WriteString("[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+
+	lanes := assHeight / assLineHeight
+	scroll := make([]float64, lanes) // 各行最近一条滚动弹幕完全进入画面的时间
+	top := make([]float64, lanes)    // 各行顶部弹幕的消失时间
+	bottom := make([]float64, lanes) // 各行底部弹幕的消失时间
+
+	for _, ev := range events {
+		start := ev.Time
+		switch {
+		case ev.Kind == KindSuperChat:
+			text := fmt.Sprintf("¥%d %s: %s", ev.Price, ev.User, ev.Text)
+			end := start + scDuration.Seconds()
+			lane := pickLane(top, start)
+			top[lane] = end
+			writeDialogue(bw, start, end, "SuperChat", fmt.Sprintf(`{\an8\pos(%d,%d)}`, assWidth/2, lane*assLineHeight), text)
+		case ev.Kind != KindDanmaku:
+		case ev.Mode == 4 || ev.Mode == 5:
+			end := start + fixedDuration.Seconds()
+			tags := assColor(ev.Color)
+			if ev.Mode == 5 {
+				lane := pickLane(top, start)
+				top[lane] = end
+				tags = fmt.Sprintf(`\an8\pos(%d,%d)`, assWidth/2, lane*assLineHeight) + tags
+			} else {
+				lane := pickLane(bottom, start)
+				bottom[lane] = end
+				tags = fmt.Sprintf(`\an2\pos(%d,%d)`, assWidth/2, assHeight-lane*assLineHeight) + tags
+			}
+			writeDialogue(bw, start, end, "Danmaku", "{"+tags+"}", ev.Text)
+		default:
+			width := utf8.RuneCountInString(ev.Text) * assFontSize
+			dur := scrollDuration.Seconds()
+			lane := pickLane(scroll, start)
+			// 弹幕尾部进入画面后同一行才能出现下一条
+			scroll[lane] = start + dur*float64(width)/float64(assWidth+width)
+			y := lane * assLineHeight
+			tags := fmt.Sprintf(`{\move(%d,%d,%d,%d)%s}`, assWidth, y, -width, y, assColor(ev.Color))
+			writeDialogue(bw, start, start+dur, "Danmaku", tags, ev.Text)
+		}
+	}
+	return bw.Flush()
+}
+
+// pickLane 选择在 t 时刻空闲的最上面一行；都被占用时选择最早空闲的一行
+func pickLane(busyUntil []float64, t float64) int {
+	best := 0
+	for i, until := range busyUntil {
+		if until <= t {
+			return i
+		}
+		if until < busyUntil[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// assColor 将 0xRRGGBB 转换为 ASS 的颜色标签，白色使用样式默认值
+func assColor(rgb int) string {
+	if rgb == 0 || rgb == 0xFFFFFF {
+		return ""
+	}
+	return fmt.Sprintf(`\c&H%02X%02X%02X&`, rgb&0xFF, rgb>>8&0xFF, rgb>>16&0xFF)
+}
+
+func writeDialogue(w *bufio.Writer, start, end float64, style, tags, text string) {
+	fmt.Fprintf(w, "Dialogue: 0,%s,%s,%s,,0,0,0,,%s%s\n", assTime(start), assTime(end), style, tags, assEscape(text))
+}
+
+// assTime 格式化为 ASS 的 H:MM:SS.cc
+func assTime(sec float64) string {
+	cs := int64(sec*100 + 0.5)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// assEscape 替换会被解析为样式标签或换行的字符
+var assEscape = strings.NewReplacer(`\`, `＼`, "{", "｛", "}", "｝", "\n", " ", "\r", "").Replace
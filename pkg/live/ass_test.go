@@ -0,0 +1,107 @@
+package live
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssTime(t *testing.T) {
+	tests := []struct {
+		sec  float64
+		want string
+	}{
+		{0, "0:00:00.00"},
+		{1.234, "0:00:01.23"},
+		{1.235, "0:00:01.24"},
+		{59.999, "0:01:00.00"},
+		{3723.5, "1:02:03.50"},
+	}
+	for _, tt := range tests {
+		if got := assTime(tt.sec); got != tt.want {
+			t.Errorf("assTime(%v) = %q, want %q", tt.sec, got, tt.want)
+		}
+	}
+}
+
+func TestAssColor(t *testing.T) {
+	tests := []struct {
+		rgb  int
+		want string
+	}{
+		{0, ""},
+		{0xFFFFFF, ""},
+		{0xFF0000, `\c&H0000FF&`},
+		{0x123456, `\c&H563412&`},
+	}
+	for _, tt := range tests {
+		if got := assColor(tt.rgb); got != tt.want {
+			t.Errorf("assColor(%#x) = %q, want %q", tt.rgb, got, tt.want)
+		}
+	}
+}
+
+func TestPickLane(t *testing.T) {
+	tests := []struct {
+		busy []float64
+		t    float64
+		want int
+	}{
+		{[]float64{0, 0, 0}, 1, 0},
+		{[]float64{5, 0, 0}, 1, 1},
+		{[]float64{5, 1, 0}, 1, 1},
+		{[]float64{5, 3, 4}, 1, 1},
+	}
+	for _, tt := range tests {
+		if got := pickLane(tt.busy, tt.t); got != tt.want {
+			t.Errorf("pickLane(%v, %v) = %d, want %d", tt.busy, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestWriteASS(t *testing.T) {
+	events := []DanmakuEvent{
+		{Kind: KindDanmaku, Time: 1, Text: "第一条", Mode: 1, Color: 0xFFFFFF},
+		{Kind: KindDanmaku, Time: 1.5, Text: "第二条", Mode: 1, Color: 0xFF0000},
+		{Kind: KindDanmaku, Time: 2, Text: "顶部", Mode: 5},
+		{Kind: KindDanmaku, Time: 2, Text: "底部", Mode: 4},
+		{Kind: KindGift, Time: 3, User: "粉丝", Gift: "辣条", Count: 1},
+		{Kind: KindSuperChat, Time: 4, User: "老板", Text: "加油", Price: 30},
+		{Kind: KindDanmaku, Time: 5, Text: `a{\b1}b` + "\nc", Mode: 1},
+	}
+	var b strings.Builder
+	if err := WriteASS(&b, events); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, section := range []string{"[Script Info]", "PlayResX: 1920", "[V4+ Styles]", "Style: Danmaku,", "Style: SuperChat,", "[Events]"} {
+		if !strings.Contains(out, section) {
+			t.Errorf("output missing %q", section)
+		}
+	}
+
+	var dialogues []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "Dialogue: ") {
+			dialogues = append(dialogues, line)
+		}
+	}
+	// 礼物不进入字幕
+	want := []string{
+		`Dialogue: 0,0:00:01.00,0:00:11.00,Danmaku,,0,0,0,,{\move(1920,0,-150,0)}第一条`,
+		// 第一行的弹幕尾部尚未进入画面，第二条换到下一行
+		`Dialogue: 0,0:00:01.50,0:00:11.50,Danmaku,,0,0,0,,{\move(1920,56,-150,56)\c&H0000FF&}第二条`,
+		`Dialogue: 0,0:00:02.00,0:00:06.00,Danmaku,,0,0,0,,{\an8\pos(960,0)}顶部`,
+		`Dialogue: 0,0:00:02.00,0:00:06.00,Danmaku,,0,0,0,,{\an2\pos(960,1080)}底部`,
+		// 顶部第一行仍被占用
+		`Dialogue: 0,0:00:04.00,0:00:12.00,SuperChat,,0,0,0,,{\an8\pos(960,56)}¥30 老板: 加油`,
+		`Dialogue: 0,0:00:05.00,0:00:15.00,Danmaku,,0,0,0,,{\move(1920,0,-450,0)}a｛＼b1｝b c`,
+	}
+	if len(dialogues) != len(want) {
+		t.Fatalf("got %d dialogues, want %d:\n%s", len(dialogues), len(want), strings.Join(dialogues, "\n"))
+	}
+	for i := range want {
+		if dialogues[i] != want[i] {
+			t.Errorf("dialogue %d =\n%s\nwant\n%s", i, dialogues[i], want[i])
+		}
+	}
+}
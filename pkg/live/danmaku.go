@@ -0,0 +1,317 @@
+package live
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/websocket"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/retry"
+)
+
+// 弹幕协议的操作码
+const (
+	opHeartbeat      = 2 // 客户端心跳
+	opHeartbeatReply = 3 // 心跳回复，正文为人气值
+	opMessage        = 5 // 弹幕、礼物等通知，正文为 JSON
+	opAuth           = 7 // 客户端认证
+	opAuthReply      = 8 // 认证结果
+)
+
+// 数据包正文的编码（协议版本）
+const (
+	protoJSON   = 0 // 未压缩的 JSON
+	protoInt32  = 1 // 心跳回复中的整数
+	protoZlib   = 2 // zlib 压缩的若干个数据包
+	protoBrotli = 3 // brotli 压缩的若干个数据包
+)
+
+const (
+	packetHeaderLen   = 16
+	heartbeatInterval = 30 * time.Second
+	defaultDanmuHost  = "broadcastlv.chat.bilibili.com"
+)
+
+// 弹幕事件的类型
+const (
+	KindDanmaku   = "danmaku"
+	KindGift      = "gift"
+	KindSuperChat = "superchat"
+)
+
+// DanmakuEvent 一条弹幕、礼物或醒目留言
+type DanmakuEvent struct {
+	Kind     string  `json:"kind"`
+	Time     float64 `json:"time"` // 相对录像分段开始的秒数
+	UID      int64   `json:"uid,omitempty"`
+	User     string  `json:"user"`
+	Text     string  `json:"text,omitempty"`
+	Mode     int     `json:"mode,omitempty"`     // 弹幕位置：1 滚动，4 底部，5 顶部
+	Color    int     `json:"color,omitempty"`    // 弹幕颜色 0xRRGGBB
+	Gift     string  `json:"gift,omitempty"`     // 礼物名称
+	Count    int     `json:"count,omitempty"`    // 礼物数量
+	Price    int     `json:"price,omitempty"`    // 醒目留言的金额（元）
+	Duration int     `json:"duration,omitempty"` // 醒目留言的展示秒数
+}
+
+// CaptureDanmaku 连接直播间的弹幕服务器，将收到的弹幕、礼物和醒目留言交给 handle，
+// 直到 ctx 取消；断线后自动重连。roomID 须为真实房间号
+func CaptureDanmaku(ctx context.Context, roomID int64, handle func(DanmakuEvent)) error {
+	failures := 0
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := danmakuSession(ctx, roomID, handle)
+		if ctx.Err() != nil {
+			break
+		}
+		// 连接维持了一段时间才断开时重新计数
+		if time.Since(started) > time.Minute {
+			failures = 0
+		}
+		failures++
+		if failures > maxReconnects {
+			return fmt.Errorf("连续 %d 次连接弹幕服务器失败: %w", failures-1, err)
+		}
+		select {
+		case <-time.After(retry.Default.Delay(min(failures, 5))):
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+// danmakuSession 建立一次弹幕连接并持续读取，直到连接断开或 ctx 取消
+func danmakuSession(ctx context.Context, roomID int64, handle func(DanmakuEvent)) error {
+	info, err := api.GetDanmuInfo(roomID)
+	if err != nil {
+		return fmt.Errorf("获取弹幕服务器失败: %w", err)
+	}
+	host, port := defaultDanmuHost, 443
+	if len(info.Hosts) > 0 {
+		host, port = info.Hosts[0].Host, info.Hosts[0].WSSPort
+	}
+	cfg, err := websocket.NewConfig(fmt.Sprintf("wss://%s:%d/sub", host, port), "https://live.bilibili.com")
+	if err != nil {
+		return err
+	}
+	cfg.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	ws, err := cfg.DialContext(ctx)
+	if err != nil {
+		return fmt.Errorf("连接弹幕服务器失败: %w", err)
+	}
+	defer ws.Close()
+	// ctx 取消时关闭连接以结束阻塞的读取
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+
+	auth, _ := json.Marshal(map[string]any{
+		"uid":      0,
+		"roomid":   roomID,
+		"protover": protoZlib,
+		"buvid":    info.Buvid,
+		"platform": "web",
+		"type":     2,
+		"key":      info.Token,
+	})
+	if err := websocket.Message.Send(ws, encodePacket(opAuth, auth)); err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			if err := websocket.Message.Send(ws, encodePacket(opHeartbeat, []byte("[object Object]"))); err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			select {
+			case herr := <-errc:
+				return herr
+			default:
+				return err
+			}
+		}
+		packets, err := decodePackets(data)
+		if err != nil {
+			return err
+		}
+		for _, p := range packets {
+			switch p.op {
+			case opAuthReply:
+				var reply struct {
+					Code int `json:"code"`
+				}
+				if json.Unmarshal(p.body, &reply) == nil && reply.Code != 0 {
+					return fmt.Errorf("弹幕服务器认证失败: code %d", reply.Code)
+				}
+			case opMessage:
+				if ev, ok := parseDanmakuMessage(p.body); ok {
+					handle(ev)
+				}
+			}
+		}
+	}
+}
+
+type packet struct {
+	proto uint16
+	op    uint32
+	body  []byte
+}
+
+// encodePacket 按 16 字节头部（总长度、头部长度、协议版本、操作码、序号）封装数据包
+func encodePacket(op uint32, body []byte) []byte {
+	buf := make([]byte, packetHeaderLen+len(body))
+	binary.BigEndian.PutUint32(buf[0:], uint32(len(buf)))
+	binary.BigEndian.PutUint16(buf[4:], packetHeaderLen)
+	binary.BigEndian.PutUint16(buf[6:], protoInt32)
+	binary.BigEndian.PutUint32(buf[8:], op)
+	binary.BigEndian.PutUint32(buf[12:], 1)
+	copy(buf[packetHeaderLen:], body)
+	return buf
+}
+
+// decodePackets 拆分一个 WebSocket 消息中的数据包，压缩的正文解压后递归拆分
+func decodePackets(data []byte) ([]packet, error) {
+	var packets []packet
+	for len(data) > 0 {
+		if len(data) < packetHeaderLen {
+			return nil, errors.New("弹幕数据包不完整")
+		}
+		total := int(binary.BigEndian.Uint32(data[0:]))
+		header := int(binary.BigEndian.Uint16(data[4:]))
+		if total < header || header < packetHeaderLen || total > len(data) {
+			return nil, fmt.Errorf("弹幕数据包长度无效: %d", total)
+		}
+		p := packet{
+			proto: binary.BigEndian.Uint16(data[6:]),
+			op:    binary.BigEndian.Uint32(data[8:]),
+			body:  data[header:total],
+		}
+		data = data[total:]
+
+		switch {
+		case p.op != opMessage:
+			packets = append(packets, p)
+		case p.proto == protoZlib || p.proto == protoBrotli:
+			inner, err := decompress(p.proto, p.body)
+			if err != nil {
+				return nil, err
+			}
+			sub, err := decodePackets(inner)
+			if err != nil {
+				return nil, err
+			}
+			packets = append(packets, sub...)
+		default:
+			packets = append(packets, p)
+		}
+	}
+	return packets, nil
+}
+
+// decompress 解压 zlib 或 brotli 压缩的正文
+func decompress(proto uint16, body []byte) ([]byte, error) {
+	if proto == protoBrotli {
+		return io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// parseDanmakuMessage 解析通知消息，只保留弹幕、礼物和醒目留言
+func parseDanmakuMessage(body []byte) (DanmakuEvent, bool) {
+	var msg struct {
+		Cmd  string          `json:"cmd"`
+		Info json.RawMessage `json:"info"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return DanmakuEvent{}, false
+	}
+	// 部分消息的 cmd 带有版本后缀，如 DANMU_MSG:4:0:2:2:2:0
+	cmd, _, _ := strings.Cut(msg.Cmd, ":")
+	switch cmd {
+	case "DANMU_MSG":
+		// info: [[0, mode, fontsize, color, ...], text, [uid, uname, ...], ...]
+		var info []json.RawMessage
+		if json.Unmarshal(msg.Info, &info) != nil || len(info) < 3 {
+			return DanmakuEvent{}, false
+		}
+		var meta []any
+		var user []any
+		ev := DanmakuEvent{Kind: KindDanmaku, Mode: 1, Color: 0xFFFFFF}
+		if json.Unmarshal(info[1], &ev.Text) != nil {
+			return DanmakuEvent{}, false
+		}
+		if json.Unmarshal(info[0], &meta) == nil && len(meta) > 3 {
+			if v, ok := meta[1].(float64); ok {
+				ev.Mode = int(v)
+			}
+			if v, ok := meta[3].(float64); ok {
+				ev.Color = int(v)
+			}
+		}
+		if json.Unmarshal(info[2], &user) == nil && len(user) > 1 {
+			if v, ok := user[0].(float64); ok {
+				ev.UID = int64(v)
+			}
+			ev.User, _ = user[1].(string)
+		}
+		return ev, true
+	case "SEND_GIFT":
+		var d struct {
+			UID      int64  `json:"uid"`
+			Uname    string `json:"uname"`
+			Action   string `json:"action"`
+			GiftName string `json:"giftName"`
+			Num      int    `json:"num"`
+		}
+		if json.Unmarshal(msg.Data, &d) != nil {
+			return DanmakuEvent{}, false
+		}
+		return DanmakuEvent{Kind: KindGift, UID: d.UID, User: d.Uname, Text: d.Action, Gift: d.GiftName, Count: d.Num}, true
+	case "SUPER_CHAT_MESSAGE":
+		var d struct {
+			UID      int64  `json:"uid"`
+			Message  string `json:"message"`
+			Price    int    `json:"price"`
+			Time     int    `json:"time"`
+			UserInfo struct {
+				Uname string `json:"uname"`
+			} `json:"user_info"`
+		}
+		if json.Unmarshal(msg.Data, &d) != nil {
+			return DanmakuEvent{}, false
+		}
+		return DanmakuEvent{Kind: KindSuperChat, UID: d.UID, User: d.UserInfo.Uname, Text: d.Message, Price: d.Price, Duration: d.Time}, true
+	}
+	return DanmakuEvent{}, false
+}
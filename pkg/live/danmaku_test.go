@@ -0,0 +1,147 @@
+package live
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// rawPacket 按指定的协议版本和操作码封装数据包
+func rawPacket(proto uint16, op uint32, body []byte) []byte {
+	buf := encodePacket(op, body)
+	binary.BigEndian.PutUint16(buf[6:], proto)
+	return buf
+}
+
+func zlibBytes(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func brotliBytes(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	bw := brotli.NewWriter(&b)
+	if _, err := bw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDecodePackets(t *testing.T) {
+	msg1 := []byte(`{"cmd":"DANMU_MSG"}`)
+	msg2 := []byte(`{"cmd":"SEND_GIFT"}`)
+	inner := append(rawPacket(protoJSON, opMessage, msg1), rawPacket(protoJSON, opMessage, msg2)...)
+	heartbeat := rawPacket(protoInt32, opHeartbeatReply, []byte{0, 0, 0, 42})
+
+	tests := []struct {
+		name   string
+		data   []byte
+		bodies [][]byte
+	}{
+		{"empty", nil, nil},
+		{"single", rawPacket(protoJSON, opMessage, msg1), [][]byte{msg1}},
+		{"concatenated", append(append([]byte{}, heartbeat...), rawPacket(protoJSON, opMessage, msg2)...), [][]byte{{0, 0, 0, 42}, msg2}},
+		{"zlib", rawPacket(protoZlib, opMessage, zlibBytes(t, inner)), [][]byte{msg1, msg2}},
+		{"brotli", rawPacket(protoBrotli, opMessage, brotliBytes(t, inner)), [][]byte{msg1, msg2}},
+		{"brotli then plain", append(rawPacket(protoBrotli, opMessage, brotliBytes(t, rawPacket(protoJSON, opMessage, msg2))), rawPacket(protoJSON, opMessage, msg1)...), [][]byte{msg2, msg1}},
+		// 只有通知消息的正文可能被压缩
+		{"compressed flag on other op", rawPacket(protoZlib, opAuthReply, []byte(`{"code":0}`)), [][]byte{[]byte(`{"code":0}`)}},
+	}
+	for _, tt := range tests {
+		packets, err := decodePackets(tt.data)
+		if err != nil {
+			t.Errorf("%s: decodePackets error: %v", tt.name, err)
+			continue
+		}
+		if len(packets) != len(tt.bodies) {
+			t.Errorf("%s: got %d packets, want %d", tt.name, len(packets), len(tt.bodies))
+			continue
+		}
+		for i, p := range packets {
+			if !bytes.Equal(p.body, tt.bodies[i]) {
+				t.Errorf("%s: packet %d body = %q, want %q", tt.name, i, p.body, tt.bodies[i])
+			}
+		}
+	}
+}
+
+func TestDecodePacketsErrors(t *testing.T) {
+	valid := rawPacket(protoJSON, opMessage, []byte(`{}`))
+	tooLong := append([]byte{}, valid...)
+	binary.BigEndian.PutUint32(tooLong[0:], uint32(len(valid)+1))
+	shortHeader := append([]byte{}, valid...)
+	binary.BigEndian.PutUint16(shortHeader[4:], 8)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", valid[:10]},
+		{"length beyond data", tooLong},
+		{"header too short", shortHeader},
+		{"trailing bytes", append(append([]byte{}, valid...), 0, 0, 0)},
+		{"bad zlib", rawPacket(protoZlib, opMessage, []byte("not zlib"))},
+		{"bad brotli", rawPacket(protoBrotli, opMessage, []byte("not brotli"))},
+	}
+	for _, tt := range tests {
+		if _, err := decodePackets(tt.data); err == nil {
+			t.Errorf("%s: decodePackets error = nil", tt.name)
+		}
+	}
+}
+
+func TestParseDanmakuMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want DanmakuEvent
+		ok   bool
+	}{
+		{
+			"danmaku",
+			`{"cmd":"DANMU_MSG:4:0:2:2:2:0","info":[[0,5,25,16711680],"你好",[123,"观众"]]}`,
+			DanmakuEvent{Kind: KindDanmaku, UID: 123, User: "观众", Text: "你好", Mode: 5, Color: 0xFF0000},
+			true,
+		},
+		{
+			"danmaku without meta",
+			`{"cmd":"DANMU_MSG","info":[[],"hi",[]]}`,
+			DanmakuEvent{Kind: KindDanmaku, Text: "hi", Mode: 1, Color: 0xFFFFFF},
+			true,
+		},
+		{
+			"gift",
+			`{"cmd":"SEND_GIFT","data":{"uid":7,"uname":"粉丝","action":"投喂","giftName":"辣条","num":3}}`,
+			DanmakuEvent{Kind: KindGift, UID: 7, User: "粉丝", Text: "投喂", Gift: "辣条", Count: 3},
+			true,
+		},
+		{
+			"superchat",
+			`{"cmd":"SUPER_CHAT_MESSAGE","data":{"uid":9,"message":"加油","price":30,"time":60,"user_info":{"uname":"老板"}}}`,
+			DanmakuEvent{Kind: KindSuperChat, UID: 9, User: "老板", Text: "加油", Price: 30, Duration: 60},
+			true,
+		},
+		{"other cmd", `{"cmd":"INTERACT_WORD","data":{}}`, DanmakuEvent{}, false},
+		{"short info", `{"cmd":"DANMU_MSG","info":[[0,1]]}`, DanmakuEvent{}, false},
+		{"invalid json", `{"cmd":`, DanmakuEvent{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDanmakuMessage([]byte(tt.body))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: parseDanmakuMessage = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
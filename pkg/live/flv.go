@@ -0,0 +1,148 @@
+package live
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// FLV tag 类型
+const (
+	flvAudio  = 8
+	flvVideo  = 9
+	flvScript = 18
+)
+
+// flvHeaderLen FLV 文件头加上第一个 PreviousTagSize 的长度
+const flvHeaderLen = 13
+
+// flvTag FLV 中的一个 tag，ts 为毫秒时间戳
+type flvTag struct {
+	typ  byte
+	ts   uint32
+	data []byte
+}
+
+// readFLVHeader 读取 FLV 文件头和第一个 PreviousTagSize
+func readFLVHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, flvHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:3]) != "FLV" {
+		return nil, errors.New("直播流不是 FLV 格式")
+	}
+	return header, nil
+}
+
+// readFLVTag 读取一个 tag 及其后的 PreviousTagSize
+func readFLVTag(r io.Reader) (flvTag, error) {
+	var head [11]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return flvTag{}, err
+	}
+	size := int(head[1])<<16 | int(head[2])<<8 | int(head[3])
+	t := flvTag{
+		typ:  head[0] & 0x1f,
+		ts:   uint32(head[7])<<24 | uint32(head[4])<<16 | uint32(head[5])<<8 | uint32(head[6]),
+		data: make([]byte, size+4),
+	}
+	if _, err := io.ReadFull(r, t.data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return flvTag{}, err
+	}
+	t.data = t.data[:size]
+	return t, nil
+}
+
+// writeFLVTag 写入 tag 及其 PreviousTagSize，返回写入的字节数
+func writeFLVTag(w io.Writer, t flvTag) (int, error) {
+	buf := make([]byte, 11+len(t.data)+4)
+	buf[0] = t.typ
+	buf[1], buf[2], buf[3] = byte(len(t.data)>>16), byte(len(t.data)>>8), byte(len(t.data))
+	buf[4], buf[5], buf[6], buf[7] = byte(t.ts>>16), byte(t.ts>>8), byte(t.ts), byte(t.ts>>24)
+	copy(buf[11:], t.data)
+	binary.BigEndian.PutUint32(buf[11+len(t.data):], uint32(11+len(t.data)))
+	return w.Write(buf)
+}
+
+// sequenceHeader 是否为 AVC/HEVC 或 AAC 的编码参数（sequence header）
+func (t flvTag) sequenceHeader() bool {
+	if len(t.data) < 2 {
+		return false
+	}
+	switch t.typ {
+	case flvVideo:
+		if t.data[0]&0x80 != 0 { // Enhanced RTMP，低 4 位为包类型
+			return t.data[0]&0x0f == 0
+		}
+		codec := t.data[0] & 0x0f
+		return (codec == 7 || codec == 12) && t.data[1] == 0
+	case flvAudio:
+		return t.data[0]>>4 == 10 && t.data[1] == 0
+	}
+	return false
+}
+
+// keyframe 是否为视频关键帧（不含编码参数）
+func (t flvTag) keyframe() bool {
+	return t.typ == flvVideo && len(t.data) > 0 && (t.data[0]>>4)&7 == 1 && !t.sequenceHeader()
+}
+
+// flvSegments 在同一个连接上切分 FLV 流：缓存文件头、元数据和编码参数，
+// 新分段以这些数据开头，时间戳从 0 开始
+type flvSegments struct {
+	header []byte
+	script *flvTag
+	video  *flvTag
+	audio  *flvTag
+	base   uint32
+}
+
+// observe 记录元数据和最新的编码参数
+func (s *flvSegments) observe(t flvTag) {
+	switch {
+	case t.typ == flvScript && s.script == nil:
+		s.script = &t
+	case t.typ == flvVideo && t.sequenceHeader():
+		s.video = &t
+	case t.typ == flvAudio && t.sequenceHeader():
+		s.audio = &t
+	}
+}
+
+// start 在 w 开始新的分段，之后写入的 tag 以 base 为零点。
+// 第一个分段原样保留时间戳，缓存的数据会随流本身写入
+func (s *flvSegments) start(w io.Writer, base uint32, first bool) (int64, error) {
+	s.base = base
+	n, err := w.Write(s.header)
+	size := int64(n)
+	if err != nil || first {
+		return size, err
+	}
+	for _, t := range []*flvTag{s.script, s.video, s.audio} {
+		if t == nil {
+			continue
+		}
+		c := *t
+		c.ts = 0
+		n, err := writeFLVTag(w, c)
+		size += int64(n)
+		if err != nil {
+			return size, err
+		}
+	}
+	return size, nil
+}
+
+// write 写入 tag，时间戳减去分段的零点
+func (s *flvSegments) write(w io.Writer, t flvTag) (int, error) {
+	if t.ts >= s.base {
+		t.ts -= s.base
+	} else {
+		t.ts = 0
+	}
+	return writeFLVTag(w, t)
+}
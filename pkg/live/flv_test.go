@@ -0,0 +1,136 @@
+package live
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestFLVTagKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      flvTag
+		seq, key bool
+	}{
+		{"avc sequence header", flvTag{typ: flvVideo, data: []byte{0x17, 0}}, true, false},
+		{"avc keyframe", flvTag{typ: flvVideo, data: []byte{0x17, 1}}, false, true},
+		{"avc inter frame", flvTag{typ: flvVideo, data: []byte{0x27, 1}}, false, false},
+		{"hevc sequence header", flvTag{typ: flvVideo, data: []byte{0x1c, 0}}, true, false},
+		{"enhanced sequence start", flvTag{typ: flvVideo, data: []byte{0x90, 'h', 'v', 'c', '1'}}, true, false},
+		{"enhanced coded frames", flvTag{typ: flvVideo, data: []byte{0x91, 'h', 'v', 'c', '1'}}, false, true},
+		{"aac sequence header", flvTag{typ: flvAudio, data: []byte{0xaf, 0}}, true, false},
+		{"aac raw", flvTag{typ: flvAudio, data: []byte{0xaf, 1}}, false, false},
+		{"script", flvTag{typ: flvScript, data: []byte{2, 0}}, false, false},
+		{"empty video", flvTag{typ: flvVideo}, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.tag.sequenceHeader(); got != tt.seq {
+			t.Errorf("%s: sequenceHeader = %v, want %v", tt.name, got, tt.seq)
+		}
+		if got := tt.tag.keyframe(); got != tt.key {
+			t.Errorf("%s: keyframe = %v, want %v", tt.name, got, tt.key)
+		}
+	}
+}
+
+func readAllTags(t *testing.T, data []byte) ([]byte, []flvTag) {
+	r := bytes.NewReader(data)
+	header, err := readFLVHeader(r)
+	if err != nil {
+		t.Fatalf("readFLVHeader error: %v", err)
+	}
+	var tags []flvTag
+	for {
+		tag, err := readFLVTag(r)
+		if err == io.EOF {
+			return header, tags
+		}
+		if err != nil {
+			t.Fatalf("readFLVTag error: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+}
+
+func TestFLVSegments(t *testing.T) {
+	header := []byte{'F', 'L', 'V', 1, 5, 0, 0, 0, 9, 0, 0, 0, 0}
+	script := flvTag{typ: flvScript, data: []byte{2, 0, 10, 'o', 'n', 'M', 'e', 't', 'a', 'D', 'a', 't', 'a'}}
+	vseq := flvTag{typ: flvVideo, data: []byte{0x17, 0, 0, 0, 0, 1}}
+	aseq := flvTag{typ: flvAudio, data: []byte{0xaf, 0, 0x12, 0x10}}
+	stream := []flvTag{
+		script, vseq, aseq,
+		{typ: flvVideo, ts: 0, data: []byte{0x17, 1, 0, 0, 0, 'a'}},
+		{typ: flvAudio, ts: 20, data: []byte{0xaf, 1, 'b'}},
+		{typ: flvVideo, ts: 40, data: []byte{0x27, 1, 0, 0, 0, 'c'}},
+		{typ: flvAudio, ts: 0x1000010, data: []byte{0xaf, 1, 'd'}},
+		{typ: flvVideo, ts: 0x1000020, data: []byte{0x17, 1, 0, 0, 0, 'e'}},
+		{typ: flvAudio, ts: 0x1000030, data: []byte{0xaf, 1, 'f'}},
+	}
+	var src bytes.Buffer
+	src.Write(header)
+	for _, tag := range stream {
+		if _, err := writeFLVTag(&src, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gotHeader, parsed := readAllTags(t, src.Bytes())
+	if !bytes.Equal(gotHeader, header) || !reflect.DeepEqual(parsed, stream) {
+		t.Fatalf("round trip = %v %+v, want %v %+v", gotHeader, parsed, header, stream)
+	}
+
+	// 与 recordFLV 相同：第一个分段原样写入，在第二个关键帧处切换到新分段
+	seg := &flvSegments{header: header}
+	var parts []*bytes.Buffer
+	var size int64
+	for i, tag := range parsed {
+		seg.observe(tag)
+		if len(parts) == 0 || (i > 3 && tag.keyframe()) {
+			parts = append(parts, &bytes.Buffer{})
+			first := len(parts) == 1
+			base := tag.ts
+			if first {
+				base = 0
+			}
+			n, err := seg.start(parts[len(parts)-1], base, first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size = n
+		}
+		n, err := seg.write(parts[len(parts)-1], tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += int64(n)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	if size != int64(parts[1].Len()) {
+		t.Errorf("size = %d, want %d", size, parts[1].Len())
+	}
+	if !bytes.Equal(parts[0].Bytes(), src.Bytes()[:parts[0].Len()]) || parts[0].Len() >= src.Len() {
+		t.Errorf("first part is not a prefix of the stream")
+	}
+	gotHeader, second := readAllTags(t, parts[1].Bytes())
+	want := []flvTag{
+		script, vseq, aseq,
+		{typ: flvVideo, ts: 0, data: []byte{0x17, 1, 0, 0, 0, 'e'}},
+		{typ: flvAudio, ts: 0x10, data: []byte{0xaf, 1, 'f'}},
+	}
+	if !bytes.Equal(gotHeader, header) || !reflect.DeepEqual(second, want) {
+		t.Errorf("second part = %+v, want %+v", second, want)
+	}
+}
+
+func TestReadFLVErrors(t *testing.T) {
+	if _, err := readFLVHeader(bytes.NewReader([]byte("<html>not a stream"))); err == nil {
+		t.Error("readFLVHeader(html) error = nil")
+	}
+	var buf bytes.Buffer
+	writeFLVTag(&buf, flvTag{typ: flvVideo, data: []byte{0x17, 1, 0, 0, 0}})
+	if _, err := readFLVTag(bytes.NewReader(buf.Bytes()[:buf.Len()-6])); err != io.ErrUnexpectedEOF {
+		t.Errorf("readFLVTag(truncated) error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
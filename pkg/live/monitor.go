@@ -0,0 +1,272 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"dilidili/pkg/api"
+)
+
+// DefaultInterval 默认的开播检查间隔
+const DefaultInterval = time.Minute
+
+// RoomState 被监视的直播间状态
+type RoomState int
+
+const (
+	RoomUnknown   RoomState = iota // 尚未检查
+	RoomOffline                    // 未开播
+	RoomRecording                  // 录制中
+	RoomError                      // 检查或录制出错，下次检查时重试
+)
+
+func (s RoomState) String() string {
+	switch s {
+	case RoomUnknown:
+		return "等待检查"
+	case RoomOffline:
+		return "未开播"
+	case RoomRecording:
+		return "录制中"
+	case RoomError:
+		return "出错"
+	}
+	return fmt.Sprintf("RoomState(%d)", int(s))
+}
+
+// RoomStatus 直播间的监视状态快照
+type RoomStatus struct {
+	RoomID  int64 // 配置中的房间号（可能是短号）
+	Uname   string
+	Title   string
+	State   RoomState
+	Status  string    // 最近一条录制状态
+	Since   time.Time // 开始录制的时间
+	Checked time.Time // 最近一次检查的时间
+	Files   []string  // 本次运行中录制得到的文件
+	Err     error
+}
+
+// MonitorHandler 直播间状态变化时回调，可能在任意 goroutine 中调用
+type MonitorHandler interface {
+	OnRoomUpdate(status RoomStatus)
+}
+
+// Monitor 定时检查一组直播间，开播后自动录制，下播后结束录制
+type Monitor struct {
+	opts     Options
+	interval time.Duration
+	handler  MonitorHandler
+
+	mu    sync.Mutex
+	rooms []*room
+	wake  chan struct{}
+}
+
+type room struct {
+	status RoomStatus
+	cancel context.CancelFunc // 录制中时用于停止录制
+}
+
+// snapshot 复制当前状态，调用方需持有 m.mu
+func (r *room) snapshot() RoomStatus {
+	s := r.status
+	s.Files = append([]string(nil), s.Files...)
+	return s
+}
+
+// NewMonitor 创建监视器，interval 为 0 时使用 DefaultInterval
+func NewMonitor(rooms []int64, interval time.Duration, opts Options, handler MonitorHandler) *Monitor {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	m := &Monitor{opts: opts, interval: interval, handler: handler, wake: make(chan struct{}, 1)}
+	m.setRooms(rooms)
+	return m
+}
+
+// Rooms 返回所有直播间的状态，顺序与配置一致
+func (m *Monitor) Rooms() []RoomStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]RoomStatus, len(m.rooms))
+	for i, r := range m.rooms {
+		list[i] = r.snapshot()
+	}
+	return list
+}
+
+// SetRooms 替换监视的直播间列表：新加入的直播间立即检查，被移除的直播间停止录制
+func (m *Monitor) SetRooms(ids []int64) {
+	m.setRooms(ids)
+	m.CheckNow()
+}
+
+func (m *Monitor) setRooms(ids []int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := map[int64]*room{}
+	for _, r := range m.rooms {
+		old[r.status.RoomID] = r
+	}
+	m.rooms = m.rooms[:0:0]
+	for _, id := range ids {
+		r := old[id]
+		if r == nil {
+			r = &room{status: RoomStatus{RoomID: id}}
+		}
+		delete(old, id)
+		m.rooms = append(m.rooms, r)
+	}
+	for _, r := range old {
+		if r.cancel != nil {
+			r.cancel()
+		}
+	}
+}
+
+// SetOptions 修改录制选项，对之后开始的录制生效
+func (m *Monitor) SetOptions(opts Options) {
+	m.mu.Lock()
+	m.opts = opts
+	m.mu.Unlock()
+}
+
+// CheckNow 立即检查一次所有未在录制的直播间
+func (m *Monitor) CheckNow() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 开始监视，直到 ctx 取消；返回前等待所有录制结束并完成转封装
+func (m *Monitor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.poll(ctx, &wg)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+	}
+}
+
+// poll 检查所有未在录制的直播间，开播的启动录制
+func (m *Monitor) poll(ctx context.Context, wg *sync.WaitGroup) {
+	m.mu.Lock()
+	var idle []*room
+	for _, r := range m.rooms {
+		if r.cancel == nil {
+			idle = append(idle, r)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, r := range idle {
+		if ctx.Err() != nil {
+			return
+		}
+		info, err := api.GetLiveRoom(r.status.RoomID)
+		m.mu.Lock()
+		if !m.watching(r) {
+			m.mu.Unlock()
+			continue
+		}
+		r.status.Checked = time.Now()
+		switch {
+		case err != nil:
+			r.status.State, r.status.Err = RoomError, fmt.Errorf("检查开播状态失败: %w", err)
+		case !info.Live():
+			r.status.State, r.status.Err = RoomOffline, nil
+			r.status.Uname, r.status.Title = info.Uname, info.Title
+		default:
+			rctx, cancel := context.WithCancel(ctx)
+			r.cancel = cancel
+			r.status.State, r.status.Err = RoomRecording, nil
+			r.status.Uname, r.status.Title = info.Uname, info.Title
+			r.status.Since, r.status.Status = time.Now(), ""
+			wg.Add(1)
+			go func(r *room) {
+				defer wg.Done()
+				m.record(rctx, r)
+			}(r)
+		}
+		status := r.snapshot()
+		m.mu.Unlock()
+		m.handler.OnRoomUpdate(status)
+	}
+}
+
+// watching 房间是否仍在监视列表中，调用方需持有 m.mu
+func (m *Monitor) watching(r *room) bool {
+	for _, x := range m.rooms {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+// record 录制一个直播间直到下播，结束后回到未开播状态等待下次检查
+func (m *Monitor) record(ctx context.Context, r *room) {
+	m.mu.Lock()
+	kept, opts := len(r.status.Files), m.opts
+	m.mu.Unlock()
+	files, err := Record(ctx, r.status.RoomID, opts, roomHandler{m, r})
+
+	m.mu.Lock()
+	r.cancel()
+	r.cancel = nil
+	r.status.Checked = time.Now()
+	// 转封装后原始分段已删除，用最终的文件替换本次录制过程中记下的分段
+	r.status.Files = append(r.status.Files[:kept], files...)
+	failed := err != nil && !errors.Is(err, ErrOffline)
+	if failed {
+		r.status.State, r.status.Err = RoomError, err
+	} else {
+		r.status.State, r.status.Err = RoomOffline, nil
+	}
+	status, watching := r.snapshot(), m.watching(r)
+	m.mu.Unlock()
+	if !watching {
+		return
+	}
+	m.handler.OnRoomUpdate(status)
+	// 录制因出错结束时可能仍在直播，尽快重新检查
+	if failed {
+		m.CheckNow()
+	}
+}
+
+// roomHandler 将单个录制的状态更新到对应的直播间
+type roomHandler struct {
+	m *Monitor
+	r *room
+}
+
+func (h roomHandler) SetStatus(text string) {
+	h.update(func(s *RoomStatus) { s.Status = text })
+}
+
+func (h roomHandler) OnRecordingFile(path string) {
+	h.update(func(s *RoomStatus) { s.Files = append(s.Files, path) })
+}
+
+func (h roomHandler) update(fn func(s *RoomStatus)) {
+	h.m.mu.Lock()
+	fn(&h.r.status)
+	status, watching := h.r.snapshot(), h.m.watching(h.r)
+	h.m.mu.Unlock()
+	if watching {
+		h.m.handler.OnRoomUpdate(status)
+	}
+}
@@ -0,0 +1,561 @@
+// Package live 录制 B 站直播：解析直播间、选择直播流、断线重连、按大小或时长分段，
+// 直播结束后转封装为 MP4
+package live
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/retry"
+	"dilidili/pkg/utils"
+)
+
+// DefaultQuality 默认请求原画
+const DefaultQuality = 10000
+
+// DefaultNameTemplate 录像文件名模板：{uploader} 为主播名，{title} 为直播标题，
+// {date} 为开始录制的时间，{page} 为分段序号，{bvid} 为房间号
+const DefaultNameTemplate = "{uploader}_{title}_{date:2006-01-02_15-04-05}_{page:2}.{ext}"
+
+// 直播流格式偏好
+const (
+	FormatFLV = "flv" // http_stream FLV，兼容性最好
+	FormatHLS = "hls" // http_hls fMP4
+)
+
+// Options 录制选项
+type Options struct {
+	Quality      int           // 清晰度代码，为 0 时使用 DefaultQuality
+	Format       string        // FormatFLV 或 FormatHLS，为空时使用 FLV；偏好的格式不可用时使用另一种
+	OutputDir    string        // 为空时使用当前目录
+	NameTemplate string        // 为空时使用 DefaultNameTemplate
+	MaxSize      int64         // 单个分段的最大字节数，0 表示不限
+	MaxDuration  time.Duration // 单个分段的最长时长，0 表示不限
+	Remux        bool          // 直播结束后将各分段转封装为 MP4
+	Danmaku      bool          // 同时录制弹幕，每个分段保存一个弹幕文件并转换为同名的 ASS 字幕
+}
+
+// Handler 录制过程的回调
+type Handler interface {
+	SetStatus(text string)
+	// OnRecordingFile 每个分段（或转封装后的 MP4）完成时回调
+	OnRecordingFile(path string)
+}
+
+// ErrOffline 直播间未开播
+var ErrOffline = errors.New("直播间未开播")
+
+// maxReconnects 连续失败多少次后放弃（每次成功录到数据后重新计数）
+const maxReconnects = 10
+
+// Record 录制直播间直到直播结束或 ctx 取消，返回录制得到的文件。
+// 未开播时返回 ErrOffline。ctx 取消视为正常结束，已录制的分段照常转封装
+func Record(ctx context.Context, roomID int64, opts Options, handler Handler) ([]string, error) {
+	room, err := api.GetLiveRoom(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("获取直播间信息失败: %w", err)
+	}
+	if !room.Live() {
+		return nil, ErrOffline
+	}
+	if opts.Quality == 0 {
+		opts.Quality = DefaultQuality
+	}
+	if opts.NameTemplate == "" {
+		opts.NameTemplate = DefaultNameTemplate
+	}
+	handler.SetStatus(fmt.Sprintf("开始录制 %s 的直播: %s", room.Uname, room.Title))
+
+	rec := &recorder{ctx: ctx, room: room, opts: opts, handler: handler, start: time.Now()}
+	var danmakuDone chan struct{}
+	stopDanmaku := func() {}
+	if opts.Danmaku {
+		rec.danmaku = &danmakuWriter{}
+		dctx, cancel := context.WithCancel(ctx)
+		danmakuDone = make(chan struct{})
+		stopDanmaku = func() {
+			cancel()
+			<-danmakuDone
+		}
+		go func() {
+			defer close(danmakuDone)
+			if err := CaptureDanmaku(dctx, room.RoomID, rec.danmaku.write); err != nil {
+				handler.SetStatus(fmt.Sprintf("弹幕录制已停止: %v", err))
+			}
+		}()
+	}
+	failures := 0
+	for ctx.Err() == nil && failures < maxReconnects {
+		wrote, err := rec.session()
+		if wrote {
+			failures = 0
+		}
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		failures++
+		delay := retry.Default.Delay(min(failures, 5))
+		handler.SetStatus(fmt.Sprintf("直播流中断: %v，%.0f 秒后重连", err, delay.Seconds()))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+	if failures >= maxReconnects {
+		err = fmt.Errorf("连续 %d 次连接直播流失败", failures)
+	} else {
+		err = nil
+	}
+
+	stopDanmaku()
+	files := rec.files
+	if opts.Remux {
+		files = rec.remuxAll()
+	}
+	if rec.danmaku != nil {
+		rec.convertDanmaku()
+	}
+	handler.SetStatus(fmt.Sprintf("录制结束，共 %d 个文件", len(files)))
+	return files, err
+}
+
+type recorder struct {
+	ctx     context.Context
+	room    *api.LiveRoom
+	opts    Options
+	handler Handler
+	start   time.Time
+	part    int
+	files   []string
+	danmaku *danmakuWriter // 未录制弹幕时为 nil
+}
+
+// session 获取直播流并录制，直到直播结束（返回 nil）或连接出错；wrote 表示本次录到了数据
+func (r *recorder) session() (wrote bool, err error) {
+	var info *api.LivePlayInfo
+	err = retry.Default.DoContext(r.ctx, func() (err error) {
+		info, err = api.GetLivePlayInfo(r.room.RoomID, r.opts.Quality)
+		return err
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	if info.LiveStatus != api.LiveOnline {
+		return false, nil
+	}
+	stream, ok := SelectStream(info, r.opts.Format, r.opts.Quality)
+	if !ok {
+		return false, errors.New("没有可用的直播流")
+	}
+	if name := info.Qualities[stream.Quality]; name != "" {
+		r.handler.SetStatus(fmt.Sprintf("录制清晰度: %s（%s %s）", name, stream.Format, stream.Codec))
+	}
+
+	before := len(r.files)
+	if stream.Format == "fmp4" {
+		err = r.recordHLS(stream)
+	} else {
+		err = r.recordFLV(stream)
+	}
+	wrote = len(r.files) > before
+	if err == nil || r.ctx.Err() != nil {
+		return wrote, nil
+	}
+	// 连接断开后确认是否已下播
+	if room, rerr := api.GetLiveRoom(r.room.RoomID); rerr == nil && !room.Live() {
+		return wrote, nil
+	}
+	return wrote, err
+}
+
+// SelectStream 按格式偏好、编码（优先 AVC）和清晰度选择一路直播流
+func SelectStream(info *api.LivePlayInfo, format string, qn int) (api.LiveStream, bool) {
+	want := map[string]bool{"flv": true}
+	if format == FormatHLS {
+		want = map[string]bool{"fmp4": true}
+	}
+	best, bestScore := api.LiveStream{}, -1
+	for _, s := range info.Streams {
+		if len(s.URLs) == 0 || s.Format == "ts" {
+			continue
+		}
+		score := 0
+		if want[s.Format] {
+			score += 4
+		}
+		if s.Codec == "avc" {
+			score += 2
+		}
+		if s.Quality == qn {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = s, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// nextPath 返回下一个分段的文件路径
+func (r *recorder) nextPath(ext string) (string, error) {
+	r.part++
+	rel, err := utils.RenderNameTemplate(r.opts.NameTemplate, utils.NameFields{
+		Title:    r.room.Title,
+		Uploader: r.room.Uname,
+		BVID:     strconv.FormatInt(r.room.RoomID, 10),
+		Page:     r.part,
+		Ext:      ext,
+		Date:     r.start,
+	})
+	if err != nil {
+		return "", fmt.Errorf("文件名模板错误: %w", err)
+	}
+	path := filepath.Join(r.opts.OutputDir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if r.danmaku != nil {
+		if err := r.danmaku.rotate(path); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// finish 关闭分段文件，空文件直接删除
+func (r *recorder) finish(f *os.File) {
+	path := f.Name()
+	fi, _ := f.Stat()
+	f.Close()
+	if fi == nil || fi.Size() == 0 {
+		os.Remove(path)
+		return
+	}
+	r.files = append(r.files, path)
+	r.handler.OnRecordingFile(path)
+}
+
+// full 当前分段是否达到大小或时长上限
+func (r *recorder) full(size int64, started time.Time) bool {
+	return (r.opts.MaxSize > 0 && size >= r.opts.MaxSize) ||
+		(r.opts.MaxDuration > 0 && time.Since(started) >= r.opts.MaxDuration)
+}
+
+func (r *recorder) get(url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	req.Header.Set("Referer", "https://live.bilibili.com/")
+	resp, err := api.MediaClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := retry.CheckStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// connect 依次尝试同一路流的各个 CDN 地址
+func (r *recorder) connect(urls []string) (*http.Response, error) {
+	var err error
+	for _, u := range urls {
+		var resp *http.Response
+		if resp, err = r.get(u); err == nil {
+			return resp, nil
+		}
+	}
+	return nil, err
+}
+
+// recordFLV 录制 FLV 流。分段在关键帧处切换，不断开连接：新文件重新写入 FLV 头、
+// 元数据和编码参数，画面没有间隙
+func (r *recorder) recordFLV(stream api.LiveStream) error {
+	resp, err := r.connect(stream.URLs)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	src := bufio.NewReaderSize(resp.Body, 64<<10)
+	header, err := readFLVHeader(src)
+	if err != nil {
+		return err
+	}
+	seg := &flvSegments{header: header}
+	var (
+		f       *os.File
+		w       *bufio.Writer
+		size    int64
+		started time.Time
+	)
+	closeFile := func() {
+		if f != nil {
+			w.Flush()
+			r.finish(f)
+			f = nil
+		}
+	}
+	defer closeFile()
+	for {
+		tag, err := readFLVTag(src)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF // 直播中连接被关闭，由调用方判断是否已下播
+		}
+		if err != nil {
+			return err
+		}
+		seg.observe(tag)
+		// 第一个 tag 到达时才创建文件，避免连接立即断开时留下只有文件头的分段
+		if f == nil || (r.full(size, started) && tag.keyframe()) {
+			first := f == nil
+			closeFile()
+			path, err := r.nextPath("flv")
+			if err != nil {
+				return err
+			}
+			if f, err = os.Create(path); err != nil {
+				return err
+			}
+			w = bufio.NewWriterSize(f, 64<<10)
+			r.handler.SetStatus("正在录制: " + filepath.Base(path))
+			base := tag.ts
+			if first {
+				base = 0
+			}
+			started = time.Now()
+			if size, err = seg.start(w, base, first); err != nil {
+				return err
+			}
+		}
+		n, err := seg.write(w, tag)
+		size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// recordHLS 轮询 fMP4 HLS 播放列表并依次追加分片。分段时在新文件开头重新写入初始化分片，不会丢失画面
+func (r *recorder) recordHLS(stream api.LiveStream) error {
+	playlistURL := stream.URLs[0]
+	var (
+		f       *os.File
+		initSeg []byte
+		size    int64
+		started time.Time
+		lastSeq = int64(-1)
+	)
+	defer func() {
+		if f != nil {
+			r.finish(f)
+		}
+	}()
+	for {
+		pl, err := r.fetchPlaylist(playlistURL)
+		if err != nil {
+			return err
+		}
+		// 序号整体回退到已录制的位置之前，说明推流重启后重新编号：
+		// 视为不连续，从新的初始化分片开始新的分段，否则之后的分片都会被当作已录制而跳过
+		if last := pl.mediaSequence + int64(len(pl.segments)) - 1; lastSeq >= 0 && len(pl.segments) > 0 && last < lastSeq {
+			if f != nil {
+				r.finish(f)
+				f = nil
+			}
+			initSeg, lastSeq = nil, -1
+			r.handler.SetStatus("直播流的分片序号重置，开始新的分段")
+		}
+		if initSeg == nil && pl.initURI != "" {
+			if initSeg, err = r.fetchAll(pl.initURI); err != nil {
+				return err
+			}
+		}
+		for i, seg := range pl.segments {
+			seq := pl.mediaSequence + int64(i)
+			if seq <= lastSeq {
+				continue
+			}
+			data, err := r.fetchAll(seg)
+			if err != nil {
+				return err
+			}
+			if f != nil && r.full(size, started) {
+				r.finish(f)
+				f = nil
+			}
+			if f == nil {
+				path, err := r.nextPath("m4s")
+				if err != nil {
+					return err
+				}
+				if f, err = os.Create(path); err != nil {
+					return err
+				}
+				r.handler.SetStatus("正在录制: " + filepath.Base(path))
+				n, err := f.Write(initSeg)
+				if err != nil {
+					return err
+				}
+				size, started = int64(n), time.Now()
+			}
+			if _, err := f.Write(data); err != nil {
+				return err
+			}
+			size += int64(len(data))
+			lastSeq = seq
+		}
+		if pl.ended {
+			return nil
+		}
+		wait := pl.targetDuration / 2
+		if wait <= 0 {
+			wait = time.Second
+		}
+		select {
+		case <-time.After(wait):
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		}
+	}
+}
+
+func (r *recorder) fetchAll(url string) ([]byte, error) {
+	resp, err := r.get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// playlist 解析后的 HLS 媒体播放列表
+type playlist struct {
+	initURI        string
+	mediaSequence  int64
+	targetDuration time.Duration
+	segments       []string
+	ended          bool
+}
+
+func (r *recorder) fetchPlaylist(url string) (*playlist, error) {
+	data, err := r.fetchAll(url)
+	if err != nil {
+		return nil, err
+	}
+	return parsePlaylist(url, string(data))
+}
+
+// parsePlaylist 解析 m3u8，分片和初始化分片的地址按播放列表地址解析为绝对地址
+func parsePlaylist(base, text string) (*playlist, error) {
+	if !strings.HasPrefix(strings.TrimSpace(text), "#EXTM3U") {
+		return nil, errors.New("不是有效的 m3u8 播放列表")
+	}
+	pl := &playlist{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			pl.mediaSequence, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			sec, _ := strconv.ParseFloat(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"), 64)
+			pl.targetDuration = time.Duration(sec * float64(time.Second))
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			if _, rest, ok := strings.Cut(line, `URI="`); ok {
+				uri, _, _ := strings.Cut(rest, `"`)
+				pl.initURI = resolveURL(base, uri)
+			}
+		case line == "#EXT-X-ENDLIST":
+			pl.ended = true
+		case !strings.HasPrefix(line, "#"):
+			pl.segments = append(pl.segments, resolveURL(base, line))
+		}
+	}
+	return pl, nil
+}
+
+// resolveURL 将播放列表中的相对地址（包括以 / 或 // 开头的地址）按播放列表地址解析为绝对地址
+func resolveURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+// remuxAll 将所有分段转封装为 MP4，成功后删除原文件；失败的分段保留原文件
+func (r *recorder) remuxAll() []string {
+	var out []string
+	for _, path := range r.files {
+		mp4 := strings.TrimSuffix(path, filepath.Ext(path)) + ".mp4"
+		r.handler.SetStatus("正在转封装: " + filepath.Base(path))
+		if err := downloader.Remux(path, mp4); err != nil {
+			r.handler.SetStatus(fmt.Sprintf("转封装 %s 失败，保留原文件: %v", filepath.Base(path), err))
+			out = append(out, path)
+			continue
+		}
+		os.Remove(path)
+		out = append(out, mp4)
+		r.handler.OnRecordingFile(mp4)
+	}
+	return out
+}
+
+// convertDanmaku 关闭弹幕文件并将每个分段的弹幕转换为 ASS 字幕，没有弹幕的文件直接删除
+func (r *recorder) convertDanmaku() {
+	r.danmaku.close()
+	for _, path := range r.danmaku.paths {
+		if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+			os.Remove(path)
+			continue
+		}
+		ass := strings.TrimSuffix(path, ".danmaku.jsonl") + ".ass"
+		if err := ConvertDanmakuFile(path, ass); err != nil {
+			r.handler.SetStatus(fmt.Sprintf("弹幕转换为字幕失败: %v", err))
+		}
+	}
+}
+
+// ParseSize 解析形如 "2G"、"500M" 的文件大小，空字符串表示不限
+func ParseSize(text string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(text)), "B")
+	if s == "" {
+		return 0, nil
+	}
+	mult := int64(1)
+	switch s[len(s)-1] {
+	case 'K':
+		mult = 1 << 10
+	case 'M':
+		mult = 1 << 20
+	case 'G':
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("无效的文件大小: %q", text)
+	}
+	return int64(v * float64(mult)), nil
+}
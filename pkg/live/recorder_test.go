@@ -0,0 +1,73 @@
+package live
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveURL(t *testing.T) {
+	const base = "https://cn-gotcha.bilivideo.com/live-bvc/123/live_1_2/index.m3u8?expires=1&sign=abc"
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"1000.m4s", "https://cn-gotcha.bilivideo.com/live-bvc/123/live_1_2/1000.m4s"},
+		{"1000.m4s?trid=x", "https://cn-gotcha.bilivideo.com/live-bvc/123/live_1_2/1000.m4s?trid=x"},
+		{"../h1.m4s", "https://cn-gotcha.bilivideo.com/live-bvc/123/h1.m4s"},
+		{"/other/1.m4s", "https://cn-gotcha.bilivideo.com/other/1.m4s"},
+		{"//backup.bilivideo.com/1.m4s", "https://backup.bilivideo.com/1.m4s"},
+		{"http://other.example/1.ts", "http://other.example/1.ts"},
+	}
+	for _, tt := range tests {
+		if got := resolveURL(base, tt.ref); got != tt.want {
+			t.Errorf("resolveURL(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+	if got := resolveURL("https://host.example?x=1", "/seg.ts"); got != "https://host.example/seg.ts" {
+		t.Errorf("resolveURL without path = %q", got)
+	}
+}
+
+func TestParsePlaylist(t *testing.T) {
+	const base = "https://cdn.example/live/index.m3u8?sign=1"
+	text := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-MEDIA-SEQUENCE:1000
+#EXT-X-TARGETDURATION:1.5
+#EXT-X-MAP:URI="h1000.m4s"
+
+#EXTINF:1.00,
+1000.m4s
+#EXTINF:1.00,
+/abs/1001.m4s
+`
+	pl, err := parsePlaylist(base, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &playlist{
+		initURI:        "https://cdn.example/live/h1000.m4s",
+		mediaSequence:  1000,
+		targetDuration: 1500 * time.Millisecond,
+		segments:       []string{"https://cdn.example/live/1000.m4s", "https://cdn.example/abs/1001.m4s"},
+	}
+	if !reflect.DeepEqual(pl, want) {
+		t.Errorf("parsePlaylist =\n%+v\nwant\n%+v", pl, want)
+	}
+
+	pl, err = parsePlaylist(base, "\r\n#EXTM3U\r\n#EXT-X-TARGETDURATION:2\r\nseg.ts\r\n#EXT-X-ENDLIST\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pl.ended || pl.mediaSequence != 0 || pl.targetDuration != 2*time.Second ||
+		!reflect.DeepEqual(pl.segments, []string{"https://cdn.example/live/seg.ts"}) {
+		t.Errorf("parsePlaylist with CRLF and ENDLIST = %+v", pl)
+	}
+
+	for _, text := range []string{"", "<html></html>", "seg.ts\n#EXTM3U"} {
+		if _, err := parsePlaylist(base, text); err == nil {
+			t.Errorf("parsePlaylist(%q) error = nil", text)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/schedule"
+	"dilidili/pkg/utils"
+)
+
+// State 任务状态
+type State int
+
+const (
+	Pending  State = iota // 排队中
+	Running               // 下载中
+	Done                  // 已完成
+	Failed                // 失败
+	Paused                // 已暂停
+	Canceled              // 已取消
+)
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "排队中"
+	case Running:
+		return "下载中"
+	case Done:
+		return "已完成"
+	case Failed:
+		return "失败"
+	case Paused:
+		return "已暂停"
+	case Canceled:
+		return "已取消"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Job 队列中的一个下载任务
+type Job struct {
+	ID      int64
+	Kind    utils.Kind // 投稿视频、课堂剧集或单曲
+	VideoID string     // 投稿视频为 BV 号，其余为数字编号
+	Options downloader.Options
+	Handler downloader.ProgressHandler
+
+	mu     sync.Mutex
+	state  State
+	err    error
+	cancel context.CancelFunc // 运行中的任务用于中止下载
+	stopAs State              // 中止后进入的状态：Paused 或 Canceled
+}
+
+// Ref 返回任务对应的视频引用，Page 为下载的分P
+func (j *Job) Ref() utils.VideoRef {
+	return utils.VideoRef{Kind: j.Kind, ID: j.VideoID, Page: j.Options.Page}
+}
+
+// State 返回任务当前状态
+func (j *Job) State() State {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// Err 返回失败任务的错误
+func (j *Job) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// StateHandler 可选接口，任务的 Handler 同时实现时在任务状态变化后收到通知
+type StateHandler interface {
+	OnStateChange(job *Job)
+}
+
+func (j *Job) notify() {
+	if sh, ok := j.Handler.(StateHandler); ok {
+		sh.OnStateChange(j)
+	}
+}
+
+// Queue 按先进先出顺序执行下载任务，最多同时运行 workers 个，
+// 并且只在 Schedule 允许的时段内开始新任务
+type Queue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	jobs     []*Job
+	pending  []*Job
+	nextID   int64
+	schedule schedule.Schedule
+	wake     chan struct{}
+	running  sync.WaitGroup
+	closed   bool
+}
+
+// New 创建队列并启动 workers 个工作协程
+func New(workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{wake: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// SetSchedule 设置允许下载的时段，立即唤醒正在等待时段的工作协程重新判断
+func (q *Queue) SetSchedule(s schedule.Schedule) {
+	q.mu.Lock()
+	q.schedule = s
+	close(q.wake)
+	q.wake = make(chan struct{})
+	q.mu.Unlock()
+}
+
+// Add 将任务加入队列末尾，kind 和 id 的含义同 downloader.DownloadContext
+func (q *Queue) Add(kind utils.Kind, id string, opts downloader.Options, handler downloader.ProgressHandler) *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.nextID++
+	job := &Job{ID: q.nextID, Kind: kind, VideoID: id, Options: opts, Handler: handler}
+	q.jobs = append(q.jobs, job)
+	q.pending = append(q.pending, job)
+	q.running.Add(1)
+	q.cond.Signal()
+	return job
+}
+
+// Jobs 返回所有任务（包括已结束的），按加入顺序排列
+func (q *Queue) Jobs() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*Job(nil), q.jobs...)
+}
+
+// Wait 阻塞直到当前所有任务结束或暂停
+func (q *Queue) Wait() {
+	q.running.Wait()
+}
+
+// Close 停止工作协程，已开始的任务会继续执行完，尚未开始的任务不再执行
+func (q *Queue) Close() {
+	q.mu.Lock()
+	for range q.pending {
+		q.running.Done()
+	}
+	q.pending = nil
+	q.closed = true
+	q.cond.Broadcast()
+	close(q.wake)
+	q.wake = make(chan struct{})
+	q.mu.Unlock()
+}
+
+var (
+	// ErrNotFound 指定 ID 的任务不存在
+	ErrNotFound = errors.New("任务不存在")
+	// ErrInvalidState 任务当前状态不允许该操作
+	ErrInvalidState = errors.New("任务当前状态不允许该操作")
+)
+
+// Get 按 ID 查找任务
+func (q *Queue) Get(id int64) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Cancel 取消排队、暂停或运行中的任务，并删除已下载的临时文件
+func (q *Queue) Cancel(id int64) error {
+	return q.stop(id, Canceled)
+}
+
+// Pause 暂停排队或运行中的任务，已下载的部分保留在临时目录中，Resume 后续传
+func (q *Queue) Pause(id int64) error {
+	return q.stop(id, Paused)
+}
+
+func (q *Queue) stop(id int64, target State) error {
+	job, err := q.Get(id)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	job.mu.Lock()
+	state := job.state
+	switch {
+	case state == Running:
+		// 由工作协程在下载返回后更新状态
+		job.stopAs = target
+		job.cancel()
+		job.mu.Unlock()
+		q.mu.Unlock()
+		job.Handler.SetStatus("正在停止...")
+		return nil
+	case state == Pending:
+		q.removePending(job)
+		q.running.Done()
+	case state == Paused && target == Canceled:
+	default:
+		job.mu.Unlock()
+		q.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrInvalidState, state)
+	}
+	job.state = target
+	job.mu.Unlock()
+	q.mu.Unlock()
+	if target == Canceled {
+		downloader.RemovePartial(job.Ref().Key(), job.Options.Page)
+	}
+	job.notify()
+	job.Handler.SetStatus(target.String())
+	return nil
+}
+
+// Resume 将暂停的任务重新加入队列末尾，开始后从已下载的位置续传
+func (q *Queue) Resume(id int64) error {
+	job, err := q.Get(id)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	job.mu.Lock()
+	if job.state != Paused {
+		state := job.state
+		job.mu.Unlock()
+		q.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrInvalidState, state)
+	}
+	job.state = Pending
+	job.Options.Resume = true
+	q.pending = append(q.pending, job)
+	q.running.Add(1)
+	q.cond.Signal()
+	job.mu.Unlock()
+	q.mu.Unlock()
+	job.notify()
+	return nil
+}
+
+// removePending 从等待列表中移除任务，调用方需持有 q.mu
+func (q *Queue) removePending(job *Job) {
+	for i, j := range q.pending {
+		if j == job {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (q *Queue) worker() {
+	for {
+		job, ctx := q.next()
+		if job == nil {
+			return
+		}
+		job.notify()
+		job.mu.Lock()
+		opts := job.Options
+		job.mu.Unlock()
+
+		err := downloader.DownloadContext(ctx, job.Kind, job.VideoID, opts, job.Handler)
+
+		job.mu.Lock()
+		stopAs := job.stopAs
+		job.stopAs = 0
+		job.cancel()
+		job.cancel = nil
+		// 与清除 cancel 在同一次加锁中离开 Running，stop 不会看到没有 cancel 的运行中任务。
+		// 输出已经生成时，之后才到达的暂停或取消不影响结果
+		switch {
+		case err == nil:
+			job.state, job.err = Done, nil
+		case ctx.Err() != nil && stopAs != 0:
+			job.state, job.err = stopAs, nil
+		default:
+			job.state, job.err = Failed, err
+		}
+		state := job.state
+		job.mu.Unlock()
+		job.notify()
+		switch state {
+		case Done:
+			if stopAs != 0 {
+				job.Handler.SetStatus("下载完成")
+			}
+		case Failed:
+			job.Handler.SetStatus(fmt.Sprintf("错误: %v", err))
+		default:
+			if state == Canceled {
+				downloader.RemovePartial(job.Ref().Key(), job.Options.Page)
+			}
+			job.Handler.SetStatus(state.String())
+		}
+		q.running.Done()
+	}
+}
+
+// next 取出下一个任务并将其标记为运行中，不在允许时段内时先等待；队列关闭时返回 nil
+func (q *Queue) next() (*Job, context.Context) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			return nil, nil
+		}
+		now := time.Now()
+		if q.schedule.Allowed(now) {
+			job := q.pending[0]
+			q.pending = q.pending[1:]
+			ctx, cancel := context.WithCancel(context.Background())
+			job.mu.Lock()
+			job.state = Running
+			job.err = nil
+			job.cancel = cancel
+			job.mu.Unlock()
+			return job, ctx
+		}
+
+		// 不在时段内：通知排在最前的任务并等到下个时段开始或时段设置变化
+		open := q.schedule.NextOpen(now)
+		head := q.pending[0]
+		wake := q.wake
+		q.mu.Unlock()
+		head.Handler.SetStatus(fmt.Sprintf("等待下载时段，将于 %s 开始", open.Format("01-02 15:04")))
+		select {
+		case <-time.After(time.Until(open)):
+		case <-wake:
+		}
+		q.mu.Lock()
+	}
+}
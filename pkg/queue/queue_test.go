@@ -0,0 +1,151 @@
+package queue
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/schedule"
+	"dilidili/pkg/utils"
+)
+
+// recordingHandler 记录任务经历的状态
+type recordingHandler struct {
+	mu     sync.Mutex
+	states []State
+}
+
+func (h *recordingHandler) SetVideoProgress(float64)          {}
+func (h *recordingHandler) SetAudioProgress(float64)          {}
+func (h *recordingHandler) SetOverallProgress(float64)        {}
+func (h *recordingHandler) SetStatus(string)                  {}
+func (h *recordingHandler) OnDownloadComplete(string, string) {}
+
+func (h *recordingHandler) OnStateChange(job *Job) {
+	h.mu.Lock()
+	h.states = append(h.states, job.State())
+	h.mu.Unlock()
+}
+
+func (h *recordingHandler) recorded() []State {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]State(nil), h.states...)
+}
+
+// closedQueue 返回一个当前不在下载时段内的队列，任务只会停留在排队状态，不会真正开始下载
+func closedQueue(t *testing.T) *Queue {
+	t.Helper()
+	now := time.Now()
+	sched, err := schedule.Parse(now.Add(time.Hour).Format("15:04") + "-" + now.Add(2*time.Hour).Format("15:04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := New(1)
+	q.SetSchedule(sched)
+	t.Cleanup(q.Close)
+	return q
+}
+
+func TestStateTransitions(t *testing.T) {
+	q := closedQueue(t)
+	h := &recordingHandler{}
+	job := q.Add(utils.KindVideo, "BV17x411w7KC", downloader.Options{Page: 2}, h)
+	if job.ID != 1 || job.State() != Pending {
+		t.Fatalf("new job: ID = %d, state = %v", job.ID, job.State())
+	}
+	if got := job.Ref(); got != (utils.VideoRef{ID: "BV17x411w7KC", Page: 2}) {
+		t.Errorf("Ref() = %+v", got)
+	}
+
+	steps := []struct {
+		name string
+		op   func(int64) error
+		want State
+		err  error
+	}{
+		{"resume pending", q.Resume, Pending, ErrInvalidState},
+		{"pause pending", q.Pause, Paused, nil},
+		{"pause paused", q.Pause, Paused, ErrInvalidState},
+		{"resume paused", q.Resume, Pending, nil},
+		{"pause again", q.Pause, Paused, nil},
+		{"cancel paused", q.Cancel, Canceled, nil},
+		{"resume canceled", q.Resume, Canceled, ErrInvalidState},
+		{"cancel canceled", q.Cancel, Canceled, ErrInvalidState},
+	}
+	for _, s := range steps {
+		err := s.op(job.ID)
+		if !errors.Is(err, s.err) {
+			t.Errorf("%s: err = %v, want %v", s.name, err, s.err)
+		}
+		if got := job.State(); got != s.want {
+			t.Errorf("%s: state = %v, want %v", s.name, got, s.want)
+		}
+	}
+	if !job.Options.Resume {
+		t.Error("resumed job should continue from the partial download")
+	}
+	want := []State{Paused, Pending, Paused, Canceled}
+	if got := h.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("notified states = %v, want %v", got, want)
+	}
+}
+
+func TestCancelPendingAndWait(t *testing.T) {
+	q := closedQueue(t)
+	a := q.Add(utils.KindVideo, "BV17x411w7KC", downloader.Options{}, &recordingHandler{})
+	b := q.Add(utils.KindSong, "12", downloader.Options{}, &recordingHandler{})
+	if b.ID != a.ID+1 {
+		t.Errorf("job IDs = %d, %d; want consecutive", a.ID, b.ID)
+	}
+	if err := q.Cancel(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Pause(b.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 取消和暂停的任务都不再阻塞 Wait
+	done := make(chan struct{})
+	go func() {
+		q.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after all jobs were canceled or paused")
+	}
+
+	if got := q.Jobs(); len(got) != 2 || got[0] != a || got[1] != b {
+		t.Errorf("Jobs() = %v, want both jobs in order", got)
+	}
+	if _, err := q.Get(99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(99) err = %v, want ErrNotFound", err)
+	}
+	if err := q.Cancel(99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cancel(99) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCloseReleasesPending(t *testing.T) {
+	q := closedQueue(t)
+	job := q.Add(utils.KindVideo, "BV17x411w7KC", downloader.Options{}, &recordingHandler{})
+	q.Close()
+	done := make(chan struct{})
+	go func() {
+		q.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after Close")
+	}
+	if job.State() != Pending {
+		t.Errorf("state after Close = %v, want %v", job.State(), Pending)
+	}
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter 令牌桶限速器，速率可在运行中调整，零值表示不限速
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // 字节/秒，0 表示不限速
+	tokens float64
+	last   time.Time
+}
+
+// Global 所有下载流和任务共享的全局限速器
+var Global = &Limiter{}
+
+// minBurst 桶容量下限，保证单次读取（32KB 缓冲区）不会永远拿不到令牌
+const minBurst = 64 * 1024
+
+// SetRate 设置速率（字节/秒），<= 0 表示不限速。正在等待的读取会在下一次取令牌时按新速率计算
+func (l *Limiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	l.rate = float64(bytesPerSec)
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// Rate 返回当前速率（字节/秒），0 表示不限速
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// WaitN 消耗 n 个字节的令牌，令牌不足时阻塞到可用为止；ctx 取消时立即返回 ctx.Err()
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	burst := l.rate
+	if burst < minBurst {
+		burst = minBurst
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	// 先预留令牌，不足部分按当前速率折算为等待时间，多个读取者依次排队
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ParseRate 解析速率字符串，如 "512K"、"2M"、"1.5MB"，单位为每秒字节数；
+// 空字符串或 "0" 表示不限速
+func ParseRate(text string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(text))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/S"), "B")
+	if s == "" {
+		return 0, nil
+	}
+	mult := 1.0
+	switch s[len(s)-1] {
+	case 'K':
+		mult = 1 << 10
+	case 'M':
+		mult = 1 << 20
+	case 'G':
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("无效的速率: %q", text)
+	}
+	return int64(v * mult), nil
+}
+
+// FormatRate 将速率格式化为易读的字符串
+func FormatRate(bytesPerSec int64) string {
+	switch {
+	case bytesPerSec <= 0:
+		return "不限速"
+	case bytesPerSec >= 1<<20:
+		return strconv.FormatFloat(float64(bytesPerSec)/(1<<20), 'f', -1, 64) + " MB/s"
+	default:
+		return strconv.FormatFloat(float64(bytesPerSec)/(1<<10), 'f', -1, 64) + " KB/s"
+	}
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"1024", 1024},
+		{"512K", 512 << 10},
+		{"512k", 512 << 10},
+		{"512KB", 512 << 10},
+		{" 2M ", 2 << 20},
+		{"1.5MB", 3 << 19},
+		{"1.5mb/s", 3 << 19},
+		{"1G", 1 << 30},
+		{"100B", 100},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+	for _, input := range []string{"abc", "-1M", "M", "1T", "1 2M", "Inf", "NaN"} {
+		if got, err := ParseRate(input); err == nil {
+			t.Errorf("ParseRate(%q) = %d, want error", input, got)
+		}
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := []struct {
+		rate int64
+		want string
+	}{
+		{0, "不限速"},
+		{-1, "不限速"},
+		{512 << 10, "512 KB/s"},
+		{3 << 19, "1.5 MB/s"},
+		{2 << 20, "2 MB/s"},
+	}
+	for _, tt := range tests {
+		if got := FormatRate(tt.rate); got != tt.want {
+			t.Errorf("FormatRate(%d) = %q, want %q", tt.rate, got, tt.want)
+		}
+	}
+}
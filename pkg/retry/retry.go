@@ -0,0 +1,116 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Policy 指数退避重试策略
+type Policy struct {
+	MaxAttempts int           // 包括首次在内的最大尝试次数
+	BaseDelay   time.Duration // 第一次重试前的基础等待时间
+	MaxDelay    time.Duration // 单次等待时间上限
+}
+
+// Default api 和 downloader 共用的默认策略
+var Default = Policy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// NotifyFunc 每次重试前回调，attempt 为即将进行的第几次重试（从 1 开始）
+type NotifyFunc func(attempt int, err error, delay time.Duration)
+
+// Do 执行 fn，遇到可重试的错误时按策略退避后重试，不可重试的错误立即返回
+func (p Policy) Do(fn func() error, notify NotifyFunc) error {
+	return p.DoContext(context.Background(), fn, notify)
+}
+
+// DoContext 与 Do 相同，但 ctx 取消后不再重试，并立即结束等待
+func (p Policy) DoContext(ctx context.Context, fn func() error, notify NotifyFunc) error {
+	var err error
+	for attempt := 0; attempt < p.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := p.Delay(attempt)
+			if notify != nil {
+				notify(attempt, err, delay)
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err = fn()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || !IsRetryable(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("重试 %d 次后仍然失败: %w", p.MaxAttempts-1, err)
+}
+
+// Delay 返回第 attempt 次重试前的等待时间：指数增长并叠加随机抖动，
+// 结果落在 [d/2, d) 之间，避免多个任务同时重试
+func (p Policy) Delay(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// StatusError HTTP 状态码错误
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP 状态码 %d", e.StatusCode)
+}
+
+// Retryable 5xx、429 和 412（B 站风控）可重试，其余状态码视为永久错误
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusPreconditionFailed
+}
+
+// CheckStatus 非 2xx 响应返回 StatusError
+func CheckStatus(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// IsRetryable 判断错误是否值得重试。实现了 Retryable() bool 的错误由自身决定，
+// 超时、连接重置、连接被拒绝、连接中断可重试；域名解析失败、证书错误、代理地址错误等视为永久错误
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,106 @@
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("boom"), false},
+		{"500", &StatusError{StatusCode: 500}, true},
+		{"503 wrapped", fmt.Errorf("下载失败: %w", &StatusError{StatusCode: 503}), true},
+		{"429", &StatusError{StatusCode: 429}, true},
+		{"412", &StatusError{StatusCode: 412}, true},
+		{"403", &StatusError{StatusCode: 403}, false},
+		{"404", &StatusError{StatusCode: 404}, false},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"EOF", io.EOF, false},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"connection refused", &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, true},
+		{"broken pipe", syscall.EPIPE, true},
+		{"timeout", timeout, true},
+		{"url timeout", &url.Error{Op: "Get", URL: "https://example.com", Err: timeout}, true},
+		{"dns not found", &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, false},
+		{"certificate", &url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, false},
+		{"canceled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		full    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{70, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := p.Delay(tt.attempt); d < tt.full/2 || d > tt.full {
+				t.Errorf("Delay(%d) = %v, want within [%v, %v]", tt.attempt, d, tt.full/2, tt.full)
+				break
+			}
+		}
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	p := Policy{MaxAttempts: 3}
+	tests := []struct {
+		name     string
+		errs     []error
+		calls    int
+		notifies int
+		wantErr  bool
+	}{
+		{"success", []error{nil}, 1, 0, false},
+		{"retry then success", []error{io.ErrUnexpectedEOF, nil}, 2, 1, false},
+		{"permanent", []error{&StatusError{StatusCode: 404}}, 1, 0, true},
+		{"exhausted", []error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF}, 3, 2, true},
+	}
+	for _, tt := range tests {
+		calls, notifies := 0, 0
+		err := p.DoContext(context.Background(), func() error {
+			calls++
+			return tt.errs[calls-1]
+		}, func(int, error, time.Duration) { notifies++ })
+		if calls != tt.calls || notifies != tt.notifies || (err != nil) != tt.wantErr {
+			t.Errorf("%s: calls = %d, notifies = %d, err = %v; want %d, %d, error %v",
+				tt.name, calls, notifies, err, tt.calls, tt.notifies, tt.wantErr)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := p.DoContext(ctx, func() error {
+		cancel()
+		return io.ErrUnexpectedEOF
+	}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DoContext after cancel = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,107 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window 每天的一个允许下载时段，End 早于 Start 时表示跨过午夜
+type Window struct {
+	Start time.Duration // 距当天零点的时长
+	End   time.Duration
+}
+
+// Schedule 允许下载的时段集合，为空表示任何时间都允许
+type Schedule []Window
+
+// Parse 解析形如 "22:00-07:00,12:00-13:30" 的时段列表
+func Parse(s string) (Schedule, error) {
+	var sched Schedule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("时段格式应为 HH:MM-HH:MM: %q", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("时段的开始和结束不能相同: %q", part)
+		}
+		sched = append(sched, Window{Start: start, End: end})
+	}
+	return sched, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间: %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// String 返回与 Parse 相同格式的字符串
+func (s Schedule) String() string {
+	var parts []string
+	for _, w := range s {
+		parts = append(parts, formatClock(w.Start)+"-"+formatClock(w.End))
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// Allowed 判断 t 是否处于允许下载的时段内
+func (s Schedule) Allowed(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	offset := sinceMidnight(t)
+	for _, w := range s {
+		if w.Start < w.End {
+			if offset >= w.Start && offset < w.End {
+				return true
+			}
+		} else if offset >= w.Start || offset < w.End {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen 返回 t 之后最近一个时段的开始时间；t 已在时段内时返回 t
+func (s Schedule) NextOpen(t time.Time) time.Time {
+	if s.Allowed(t) {
+		return t
+	}
+	midnight := t.Add(-sinceMidnight(t))
+	var next time.Time
+	for _, w := range s {
+		// 时段开始时间可能在今天稍后或明天
+		for day := 0; day <= 1; day++ {
+			start := midnight.AddDate(0, 0, day).Add(w.Start)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	return next
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
@@ -0,0 +1,90 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Schedule
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"22:00-07:00", Schedule{{22 * time.Hour, 7 * time.Hour}}},
+		{"22:00-07:00, 12:00-13:30", Schedule{{22 * time.Hour, 7 * time.Hour}, {12 * time.Hour, 13*time.Hour + 30*time.Minute}}},
+		{" 9:05 - 17:00 ", Schedule{{9*time.Hour + 5*time.Minute, 17 * time.Hour}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.input, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.input, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Parse(%q) = %v, want %v", tt.input, got, tt.want)
+				break
+			}
+		}
+	}
+	for _, input := range []string{"22:00", "22:00-", "25:00-07:00", "22:00-07:60", "08:00-08:00", "a-b"} {
+		if got, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) = %v, want error", input, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	const s = "22:00-07:00,12:00-13:30"
+	sched, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sched.String(); got != s {
+		t.Errorf("String() = %q, want %q", got, s)
+	}
+}
+
+func TestAllowedAndNextOpen(t *testing.T) {
+	sched, err := Parse("22:00-07:00,12:00-13:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 5, day, hour, min, 0, 0, time.Local)
+	}
+	tests := []struct {
+		t       time.Time
+		allowed bool
+		next    time.Time
+	}{
+		{at(6, 23, 0), true, at(6, 23, 0)},
+		{at(6, 6, 59), true, at(6, 6, 59)},
+		{at(6, 7, 0), false, at(6, 12, 0)},
+		{at(6, 12, 0), true, at(6, 12, 0)},
+		{at(6, 13, 30), false, at(6, 22, 0)},
+		{at(6, 21, 59), false, at(6, 22, 0)},
+	}
+	for _, tt := range tests {
+		if got := sched.Allowed(tt.t); got != tt.allowed {
+			t.Errorf("Allowed(%v) = %v, want %v", tt.t, got, tt.allowed)
+		}
+		if got := sched.NextOpen(tt.t); !got.Equal(tt.next) {
+			t.Errorf("NextOpen(%v) = %v, want %v", tt.t, got, tt.next)
+		}
+	}
+	// 当天的时段都已结束时等到第二天
+	noon := Schedule{{12 * time.Hour, 13 * time.Hour}}
+	if got := noon.NextOpen(at(6, 14, 0)); !got.Equal(at(7, 12, 0)) {
+		t.Errorf("NextOpen after the last window = %v, want %v", got, at(7, 12, 0))
+	}
+	if !Schedule(nil).Allowed(at(6, 7, 0)) {
+		t.Error("empty schedule should allow any time")
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/queue"
+)
+
+// JobStatus 任务的对外状态快照，作为 JSON 返回给客户端
+type JobStatus struct {
+	ID       int64                `json:"id"`
+	Kind     string               `json:"kind"`     // video、cheese 或 song
+	VideoID  string               `json:"video_id"` // 投稿视频为 BV 号，其余为数字编号
+	BVID     string               `json:"bvid"`     // 投稿视频为 BV 号，课堂剧集和单曲为 ep、au 加编号
+	State    string               `json:"state"`
+	Title    string               `json:"title,omitempty"`
+	Status   string               `json:"status,omitempty"`
+	Progress float64              `json:"progress"`
+	Video    *downloader.Progress `json:"video,omitempty"`
+	Audio    *downloader.Progress `json:"audio,omitempty"`
+	Error    string               `json:"error,omitempty"`
+	Path     string               `json:"path,omitempty"`
+	Result   *downloader.Result   `json:"result,omitempty"`
+}
+
+// Event 推送给 SSE 订阅者的事件，Type 为 added、state、status、progress、info、result、done 之一
+type Event struct {
+	Type string    `json:"type"`
+	Job  JobStatus `json:"job"`
+}
+
+// hub 将事件广播给所有订阅者。处理不过来的订阅者会丢弃进度等中间事件而不阻塞下载；
+// 任务结束的事件不能丢，此时关闭该订阅者，客户端重连后从快照恢复
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func newHub() *hub {
+	return &hub{subs: map[chan Event]struct{}{}}
+}
+
+func (h *hub) subscribe() chan Event {
+	ch := make(chan Event, 64)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+// unsubscribe 取消订阅；订阅者已因处理不过来被关闭时不做任何事
+func (h *hub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+func (h *hub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			if e.terminal() {
+				delete(h.subs, ch)
+				close(ch)
+			}
+		}
+	}
+}
+
+// terminal 是否为任务结束（完成、失败或取消）的事件
+func (e Event) terminal() bool {
+	switch e.Type {
+	case "done":
+		return true
+	case "state":
+		switch e.Job.State {
+		case queue.Done.String(), queue.Failed.String(), queue.Canceled.String():
+			return true
+		}
+	}
+	return false
+}
+
+// jobHandler 实现 ProgressHandler 及其可选接口，维护任务快照并广播变化
+type jobHandler struct {
+	mu     sync.Mutex
+	job    *queue.Job
+	status JobStatus
+	hub    *hub
+	onDone func(*downloader.Result)
+}
+
+// update 在锁内修改快照并广播，job 尚未入队时只更新快照
+func (h *jobHandler) update(kind string, fn func(s *JobStatus)) {
+	h.mu.Lock()
+	fn(&h.status)
+	if h.job == nil {
+		h.mu.Unlock()
+		return
+	}
+	s := h.snapshotLocked()
+	h.mu.Unlock()
+	h.hub.publish(Event{Type: kind, Job: s})
+}
+
+func (h *jobHandler) snapshot() JobStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.snapshotLocked()
+}
+
+func (h *jobHandler) snapshotLocked() JobStatus {
+	s := h.status
+	if h.job != nil {
+		s.ID = h.job.ID
+		s.State = h.job.State().String()
+		if err := h.job.Err(); err != nil {
+			s.Error = err.Error()
+		}
+	}
+	return s
+}
+
+func (h *jobHandler) OnStateChange(job *queue.Job) {
+	h.update("state", func(s *JobStatus) {})
+}
+
+func (h *jobHandler) SetVideoProgress(p float64) {}
+func (h *jobHandler) SetAudioProgress(p float64) {}
+
+func (h *jobHandler) SetOverallProgress(p float64) {
+	h.update("progress", func(s *JobStatus) { s.Progress = p })
+}
+
+func (h *jobHandler) SetStatus(text string) {
+	h.update("status", func(s *JobStatus) { s.Status = text })
+}
+
+func (h *jobHandler) OnProgress(p downloader.Progress) {
+	h.update("progress", func(s *JobStatus) {
+		if p.Stream == downloader.StreamAudio {
+			s.Audio = &p
+		} else {
+			s.Video = &p
+		}
+	})
+}
+
+func (h *jobHandler) OnVideoInfo(info *api.VideoInfo) {
+	h.update("info", func(s *JobStatus) { s.Title = info.Data.Title })
+}
+
+func (h *jobHandler) OnDownloadResult(res *downloader.Result) {
+	h.update("result", func(s *JobStatus) { s.Result = res })
+	if h.onDone != nil {
+		h.onDone(res)
+	}
+}
+
+func (h *jobHandler) OnDownloadComplete(outputPath, title string) {
+	h.update("done", func(s *JobStatus) {
+		s.Path = outputPath
+		s.Status = fmt.Sprintf("已保存: %s", outputPath)
+	})
+}
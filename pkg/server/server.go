@@ -0,0 +1,397 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dilidili/pkg/api"
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/library"
+	"dilidili/pkg/queue"
+	"dilidili/pkg/utils"
+)
+
+// Server 通过本地 HTTP/JSON 接口操作下载队列，供浏览器扩展和其他工具调用。
+//
+//	GET  /api/resolve?url=...        解析链接并返回视频信息
+//	GET  /api/jobs                   列出所有任务
+//	POST /api/jobs                   添加任务，请求体 {"url": "...", "quality": 80}
+//	GET  /api/jobs/{id}              查询单个任务
+//	POST /api/jobs/{id}/cancel       取消任务
+//	POST /api/jobs/{id}/pause        暂停任务
+//	POST /api/jobs/{id}/resume       继续任务
+//	GET  /api/events                 以 Server-Sent Events 推送任务变化
+//
+// 所有接口都需要令牌：请求头 "Authorization: Bearer <token>"，
+// 或查询参数 ?token=<token>（EventSource 无法设置请求头时使用）。
+// 浏览器发来的跨域请求只接受配置的来源（如 chrome-extension://<扩展 ID>）
+type Server struct {
+	queue  *queue.Queue
+	opts   downloader.Options
+	token  string
+	origin string
+	lib    *library.Library
+	hub    *hub
+
+	mu   sync.Mutex
+	jobs map[int64]*jobHandler
+}
+
+// New 创建服务，opts 为新任务的默认下载选项，其输出目录同时是请求中 output_dir 的根目录；
+// origin 为允许跨域访问的来源，为空时拒绝所有浏览器跨域请求；lib 不为 nil 时下载结果记入媒体库
+func New(q *queue.Queue, opts downloader.Options, token, origin string, lib *library.Library) *Server {
+	return &Server{
+		queue:  q,
+		opts:   opts,
+		token:  token,
+		origin: strings.TrimSuffix(origin, "/"),
+		lib:    lib,
+		hub:    newHub(),
+		jobs:   map[int64]*jobHandler{},
+	}
+}
+
+// Handler 返回带鉴权和 CORS 处理的 HTTP 处理器
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/resolve", s.handleResolve)
+	mux.HandleFunc("/api/jobs", s.handleJobs)
+	mux.HandleFunc("/api/jobs/", s.handleJob)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 命令行工具不带 Origin；浏览器中的其他网页即使拿到令牌也不能调用
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if s.origin == "" || origin != s.origin {
+				writeError(w, http.StatusForbidden, fmt.Errorf("不允许来自 %s 的请求", origin))
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", s.origin)
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, errors.New("令牌无效"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe 在 addr 上提供服务，直到 ctx 取消。取消时事件推送等请求随之结束
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if srv.Shutdown(shutdownCtx) != nil {
+			srv.Close()
+		}
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// resolveResponse /api/resolve 的返回内容
+type resolveResponse struct {
+	Kind     string     `json:"kind"`
+	BVID     string     `json:"bvid"`
+	Page     int        `json:"page,omitempty"`
+	Title    string     `json:"title"`
+	Uploader string     `json:"uploader"`
+	Cover    string     `json:"cover"`
+	Duration int        `json:"duration"`
+	Pages    []api.Page `json:"pages"`
+}
+
+func (s *Server) handleResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("仅支持 GET"))
+		return
+	}
+	ref, err := api.ResolveVideoRef(r.URL.Query().Get("url"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	info, err := api.GetRefInfo(ref)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	// 互动视频列出剧情图的全部节点
+	if _, err := api.ExpandInteractive(info); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resolveResponse{
+		Kind:     ref.Kind.String(),
+		BVID:     info.Data.Bvid,
+		Page:     ref.Page,
+		Title:    info.Data.Title,
+		Uploader: info.Data.Owner.Name,
+		Cover:    info.Data.Pic,
+		Duration: info.Data.Duration,
+		Pages:    info.Data.Pages,
+	})
+}
+
+// addRequest POST /api/jobs 的请求体，未给出的字段使用服务的默认选项
+type addRequest struct {
+	URL          string `json:"url"`
+	Page         int    `json:"page"` // 为 0 时使用链接中的 p= 参数
+	Quality      int    `json:"quality"`
+	OutputDir    string `json:"output_dir"` // 相对路径基于服务的输出目录，绝对路径也必须位于其中
+	NameTemplate string `json:"name_template"`
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.list())
+	case http.MethodPost:
+		var req addRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("请求体无效: %w", err))
+			return
+		}
+		ref, err := api.ResolveVideoRef(req.URL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if ref.Kind == utils.KindMenu {
+			writeError(w, http.StatusBadRequest, errors.New("音频歌单请逐首添加单曲"))
+			return
+		}
+		opts := s.opts
+		opts.Page = ref.Page
+		if req.Page > 0 {
+			opts.Page = req.Page
+		}
+		if req.Quality != 0 {
+			if api.QualityName(req.Quality) == "" {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("不支持的清晰度代码: %d", req.Quality))
+				return
+			}
+			opts.Quality = req.Quality
+		}
+		if req.OutputDir != "" {
+			dir, err := s.outputDir(req.OutputDir)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			opts.OutputDir = dir
+		}
+		if req.NameTemplate != "" {
+			if _, err := utils.RenderNameTemplate(req.NameTemplate, utils.NameFields{Title: "t", Ext: "mp4"}); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			opts.NameTemplate = req.NameTemplate
+		}
+		writeJSON(w, http.StatusCreated, s.add(ref.Kind, ref.ID, opts))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("仅支持 GET 和 POST"))
+	}
+}
+
+// outputDir 将请求中的输出目录限制在服务的输出目录之内
+func (s *Server) outputDir(dir string) (string, error) {
+	if s.opts.OutputDir == "" {
+		return "", errors.New("服务未设置输出目录，不能指定 output_dir")
+	}
+	root, err := filepath.Abs(s.opts.OutputDir)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	dir = filepath.Clean(dir)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("output_dir 必须位于输出目录 %s 之内", root)
+	}
+	return dir, nil
+}
+
+// handleJob 处理 /api/jobs/{id} 和 /api/jobs/{id}/{action}
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, queue.ErrNotFound)
+		return
+	}
+	h := s.handler(id)
+	if h == nil {
+		writeError(w, http.StatusNotFound, queue.ErrNotFound)
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("仅支持 GET"))
+			return
+		}
+		writeJSON(w, http.StatusOK, h.snapshot())
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("仅支持 POST"))
+		return
+	}
+	switch action {
+	case "cancel":
+		err = s.queue.Cancel(id)
+	case "pause":
+		err = s.queue.Pause(id)
+	case "resume":
+		err = s.queue.Resume(id)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("未知操作: %s", action))
+		return
+	}
+	switch {
+	case errors.Is(err, queue.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, queue.ErrInvalidState):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, h.snapshot())
+	}
+}
+
+// handleEvents 以 SSE 推送任务事件，连接建立时先推送所有任务的当前状态
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("不支持流式响应"))
+		return
+	}
+	ch := s.hub.subscribe()
+	defer s.hub.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, job := range s.list() {
+		writeEvent(w, Event{Type: "snapshot", Job: job})
+	}
+	flusher.Flush()
+
+	// 定期发送注释行，防止代理或浏览器因空闲断开连接
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return // 处理不过来被关闭，客户端重连后重新获取快照
+			}
+			writeEvent(w, e)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+}
+
+// add 将任务加入队列并开始跟踪其状态
+func (s *Server) add(kind utils.Kind, id string, opts downloader.Options) JobStatus {
+	ref := utils.VideoRef{Kind: kind, ID: id}
+	h := &jobHandler{hub: s.hub, status: JobStatus{Kind: kind.String(), VideoID: id, BVID: ref.Key()}}
+	if s.lib != nil && opts.OutputDir != "" {
+		h.onDone = func(res *downloader.Result) {
+			if err := s.lib.Add(library.EntryFromResult(res)); err != nil {
+				h.SetStatus(fmt.Sprintf("写入媒体库失败: %v", err))
+			}
+		}
+	}
+	// 持有 h.mu 直到 job 就绪，工作协程的回调会等待
+	h.mu.Lock()
+	job := s.queue.Add(kind, id, opts, h)
+	h.job = job
+	status := h.snapshotLocked()
+	h.mu.Unlock()
+
+	s.mu.Lock()
+	s.jobs[job.ID] = h
+	s.mu.Unlock()
+	s.hub.publish(Event{Type: "added", Job: status})
+	return status
+}
+
+func (s *Server) handler(id int64) *jobHandler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// list 按加入顺序返回所有任务的状态
+func (s *Server) list() []JobStatus {
+	statuses := []JobStatus{}
+	for _, job := range s.queue.Jobs() {
+		if h := s.handler(job.ID); h != nil {
+			statuses = append(statuses, h.snapshot())
+		}
+	}
+	return statuses
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
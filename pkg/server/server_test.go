@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"dilidili/pkg/downloader"
+	"dilidili/pkg/queue"
+)
+
+const (
+	testToken  = "secret"
+	testOrigin = "chrome-extension://abcdefghijklmnop"
+)
+
+func TestHandlerAuth(t *testing.T) {
+	q := queue.New(1)
+	defer q.Close()
+	h := New(q, downloader.Options{}, testToken, testOrigin+"/", nil).Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		code   int
+		cors   string // 期望的 Access-Control-Allow-Origin
+	}{
+		{"no token", "GET", "/api/jobs", nil, http.StatusUnauthorized, ""},
+		{"wrong token", "GET", "/api/jobs", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized, ""},
+		{"token prefix", "GET", "/api/jobs", map[string]string{"Authorization": "Bearer secre"}, http.StatusUnauthorized, ""},
+		{"basic auth", "GET", "/api/jobs", map[string]string{"Authorization": "Basic secret"}, http.StatusUnauthorized, ""},
+		{"bearer", "GET", "/api/jobs", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK, ""},
+		{"query token", "GET", "/api/jobs?token=secret", nil, http.StatusOK, ""},
+		{"header wins over query", "GET", "/api/jobs?token=secret", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized, ""},
+		{"allowed origin", "GET", "/api/jobs", map[string]string{"Authorization": "Bearer secret", "Origin": testOrigin}, http.StatusOK, testOrigin},
+		{"other origin with token", "GET", "/api/jobs?token=secret", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden, ""},
+		{"preflight", "OPTIONS", "/api/jobs", map[string]string{"Origin": testOrigin}, http.StatusNoContent, testOrigin},
+		{"preflight from other origin", "OPTIONS", "/api/jobs", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden, ""},
+		{"unknown job", "GET", "/api/jobs/42", map[string]string{"Authorization": "Bearer secret"}, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.cors {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tt.name, got, tt.cors)
+		}
+	}
+}
+
+func TestHandlerNoOrigin(t *testing.T) {
+	q := queue.New(1)
+	defer q.Close()
+	h := New(q, downloader.Options{}, testToken, "", nil).Handler()
+	req := httptest.NewRequest("GET", "/api/jobs?token=secret", nil)
+	req.Header.Set("Origin", testOrigin)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	root := t.TempDir()
+	s := New(nil, downloader.Options{OutputDir: root}, testToken, "", nil)
+	tests := []struct {
+		dir  string
+		want string // 为空表示应拒绝
+	}{
+		{"课程", filepath.Join(root, "课程")},
+		{"a/../b", filepath.Join(root, "b")},
+		{".", root},
+		{root, root},
+		{filepath.Join(root, "sub", "dir"), filepath.Join(root, "sub", "dir")},
+		{"..", ""},
+		{"../" + filepath.Base(root) + "-other", ""},
+		{"a/../../x", ""},
+		{filepath.Dir(root), ""},
+		{root + "-other", ""},
+	}
+	for _, tt := range tests {
+		got, err := s.outputDir(tt.dir)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("outputDir(%q) = %q, want error", tt.dir, got)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("outputDir(%q) = %q, %v; want %q", tt.dir, got, err, tt.want)
+		}
+	}
+	if _, err := New(nil, downloader.Options{}, testToken, "", nil).outputDir("x"); err == nil {
+		t.Error("outputDir without a configured root: error = nil")
+	}
+}
+
+func TestHubTerminalEvents(t *testing.T) {
+	h := newHub()
+	slow := h.subscribe()
+	for i := 0; i < cap(slow); i++ {
+		h.publish(Event{Type: "progress"})
+	}
+	// 队列已满：中间事件被丢弃，订阅者保留
+	h.publish(Event{Type: "progress"})
+	h.mu.Lock()
+	_, ok := h.subs[slow]
+	h.mu.Unlock()
+	if !ok {
+		t.Fatal("subscriber removed after a dropped progress event")
+	}
+	// 结束事件不能丢：关闭处理不过来的订阅者，让客户端重连获取快照
+	h.publish(Event{Type: "state", Job: JobStatus{State: queue.Failed.String()}})
+	for range slow {
+	}
+	h.unsubscribe(slow) // 已关闭的订阅者可以再次取消
+
+	fast := h.subscribe()
+	defer h.unsubscribe(fast)
+	h.publish(Event{Type: "done"})
+	if e := <-fast; e.Type != "done" {
+		t.Errorf("event = %q, want done", e.Type)
+	}
+
+	tests := []struct {
+		e    Event
+		want bool
+	}{
+		{Event{Type: "done"}, true},
+		{Event{Type: "state", Job: JobStatus{State: queue.Done.String()}}, true},
+		{Event{Type: "state", Job: JobStatus{State: queue.Canceled.String()}}, true},
+		{Event{Type: "state", Job: JobStatus{State: queue.Running.String()}}, false},
+		{Event{Type: "state", Job: JobStatus{State: queue.Paused.String()}}, false},
+		{Event{Type: "progress"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.e.terminal(); got != tt.want {
+			t.Errorf("%s %s: terminal = %v, want %v", tt.e.Type, tt.e.Job.State, got, tt.want)
+		}
+	}
+}
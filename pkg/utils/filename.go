@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultNameTemplate 默认的输出文件名模板
+const DefaultNameTemplate = "{title}.{ext}"
+
+// maxFileNameBytes 单个文件名的最大字节数，留出余量给临时后缀
+const maxFileNameBytes = 200
+
+// NameFields 文件名模板中可引用的字段
+type NameFields struct {
+	Title    string
+	Uploader string
+	BVID     string
+	Part     string // 分 P 标题
+	Page     int
+	Cid      int
+	Quality  string
+	Ext      string
+	Date     time.Time // 视频发布时间
+}
+
+// RenderNameTemplate 渲染文件名模板，返回相对路径。
+// 模板中的 {name} 替换为对应字段，{date:layout} 按 Go 时间格式输出日期，
+// "/" 用于分隔子目录，{{ 和 }} 表示字面量花括号。每一级路径都会经过 SanitizeFileName
+func RenderNameTemplate(tpl string, f NameFields) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(tpl); i++ {
+		c := tpl[i]
+		switch {
+		case c == '{' && strings.HasPrefix(tpl[i:], "{{"):
+			b.WriteByte('{')
+			i++
+		case c == '}' && strings.HasPrefix(tpl[i:], "}}"):
+			b.WriteByte('}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(tpl[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("模板中的 { 没有闭合: %q", tpl[i:])
+			}
+			value, err := nameField(tpl[i+1:i+end], f)
+			if err != nil {
+				return "", err
+			}
+			// 字段值中的路径分隔符不应产生子目录
+			b.WriteString(strings.NewReplacer("/", "_", "\\", "_").Replace(value))
+			i += end
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	var parts []string
+	for _, p := range strings.Split(b.String(), "/") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		parts = append(parts, SanitizeFileName(p))
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("模板渲染结果为空: %q", tpl)
+	}
+	return filepath.Join(parts...), nil
+}
+
+// PagedNameTemplate 模板不能区分同一视频的各个分 P 时（如默认的 {title}.{ext}），
+// 在扩展名前加上 " P{page} {part}"，避免多 P 视频的各个文件互相覆盖
+func PagedNameTemplate(tpl string) string {
+	a, errA := RenderNameTemplate(tpl, NameFields{Title: "t", Page: 1, Part: "a", Cid: 1, Ext: "mp4"})
+	b, errB := RenderNameTemplate(tpl, NameFields{Title: "t", Page: 2, Part: "b", Cid: 2, Ext: "mp4"})
+	if errA != nil || errB != nil || a != b {
+		return tpl
+	}
+	if base, ok := strings.CutSuffix(tpl, ".{ext}"); ok {
+		return base + " P{page} {part}.{ext}"
+	}
+	return tpl + " P{page} {part}"
+}
+
+func nameField(expr string, f NameFields) (string, error) {
+	name, arg, _ := strings.Cut(expr, ":")
+	switch name {
+	case "title":
+		return f.Title, nil
+	case "uploader":
+		return f.Uploader, nil
+	case "bvid":
+		return f.BVID, nil
+	case "part":
+		return f.Part, nil
+	case "page":
+		if arg != "" {
+			width, err := strconv.Atoi(arg)
+			if err != nil {
+				return "", fmt.Errorf("无效的页码宽度: %q", arg)
+			}
+			return fmt.Sprintf("%0*d", width, f.Page), nil
+		}
+		return strconv.Itoa(f.Page), nil
+	case "cid":
+		return strconv.Itoa(f.Cid), nil
+	case "quality":
+		return f.Quality, nil
+	case "ext":
+		return f.Ext, nil
+	case "date":
+		if arg == "" {
+			arg = "2006-01-02"
+		}
+		if f.Date.IsZero() {
+			return "", nil
+		}
+		return f.Date.Format(arg), nil
+	}
+	return "", fmt.Errorf("未知的模板字段: {%s}", expr)
+}
+
+// windowsReserved Windows 下不能作为文件名（忽略扩展名）的设备名
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFileName 将任意字符串转换为各平台都合法的单级文件名：
+// 替换保留字符和控制字符，去掉结尾的点和空格，规避 Windows 保留设备名，
+// 并在保留扩展名的前提下把长度限制在 maxFileNameBytes 字节以内
+func SanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	name = strings.TrimRight(name, ". ")
+
+	ext := filepath.Ext(name)
+	if len(ext) > 16 || strings.ContainsRune(ext, ' ') {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+	// Windows 按第一个点之前的部分判断设备名，CON.tar.gz 和 NUL.info.json 同样不可用
+	stem, rest, _ := strings.Cut(base, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		base = stem + "_"
+		if rest != "" {
+			base += "." + rest
+		}
+	}
+	if len(base)+len(ext) > maxFileNameBytes {
+		base = truncateUTF8(base, maxFileNameBytes-len(ext))
+		base = strings.TrimRight(base, ". ")
+	}
+	if base == "" {
+		base = "_"
+	}
+	return base + ext
+}
+
+// truncateUTF8 按字节截断字符串，不截断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"普通标题.mp4", "普通标题.mp4"},
+		{`a<b>:c"d|e?f*.mp4`, "a_b__c_d_e_f_.mp4"},
+		{"a/b\\c", "a_b_c"},
+		{"\x01x\x7fy", "xy"},
+		{"  标题. . ", "标题"},
+		{"", "_"},
+		{"...", "_"},
+		{"CON", "CON_"},
+		{"con.txt", "con_.txt"},
+		{"aux .mp4", "aux _.mp4"},
+		{"CON.tar.gz", "CON_.tar.gz"},
+		{"NUL.info.json", "NUL_.info.json"},
+		{"COM10.mp4", "COM10.mp4"},
+		{"CONSOLE.mp4", "CONSOLE.mp4"},
+		{"a.verylongextension12345", "a.verylongextension12345"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeFileName(tt.name); got != tt.want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeFileNameLength(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+	}{
+		{strings.Repeat("a", 300) + ".mp4", ".mp4"},
+		{strings.Repeat("标", 100) + ".info.json", ".json"},
+		{strings.Repeat("标", 100), ""},
+	}
+	for _, tt := range tests {
+		got := SanitizeFileName(tt.name)
+		if len(got) > maxFileNameBytes {
+			t.Errorf("SanitizeFileName(%d bytes) has %d bytes, want at most %d", len(tt.name), len(got), maxFileNameBytes)
+		}
+		if !strings.HasSuffix(got, tt.ext) {
+			t.Errorf("SanitizeFileName(%d bytes) = %q, want extension %q kept", len(tt.name), got, tt.ext)
+		}
+		if !strings.HasPrefix(tt.name, strings.TrimSuffix(got, tt.ext)) {
+			t.Errorf("SanitizeFileName(%d bytes) = %q, cut inside a character", len(tt.name), got)
+		}
+	}
+}
+
+func TestRenderNameTemplate(t *testing.T) {
+	f := NameFields{
+		Title:    "标题: 第一集",
+		Uploader: "UP/主",
+		BVID:     "BV17x411w7KC",
+		Part:     "片头",
+		Page:     3,
+		Cid:      12345,
+		Quality:  "1080P 高清",
+		Ext:      "mp4",
+		Date:     time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+	}
+	tests := []struct {
+		tpl  string
+		want string
+	}{
+		{DefaultNameTemplate, "标题_ 第一集.mp4"},
+		{"{bvid}_P{page:03}.{ext}", "BV17x411w7KC_P003.mp4"},
+		{"{uploader}/{date}/{title} - {part}.{ext}", filepath.Join("UP_主", "2024-05-06", "标题_ 第一集 - 片头.mp4")},
+		{"{date:20060102}_{cid}_{quality}.{ext}", "20240506_12345_1080P 高清.mp4"},
+		{"{{literal}}.{ext}", "{literal}.mp4"},
+		{"//{title}//.{ext}", filepath.Join("标题_ 第一集", "_.mp4")},
+		{"CON/{bvid}", filepath.Join("CON_", "BV17x411w7KC")},
+	}
+	for _, tt := range tests {
+		got, err := RenderNameTemplate(tt.tpl, f)
+		if err != nil {
+			t.Errorf("RenderNameTemplate(%q) error: %v", tt.tpl, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("RenderNameTemplate(%q) = %q, want %q", tt.tpl, got, tt.want)
+		}
+	}
+}
+
+func TestRenderNameTemplateErrors(t *testing.T) {
+	for _, tpl := range []string{
+		"{title",
+		"{unknown}.{ext}",
+		"{page:x}.{ext}",
+		"/ /",
+		"{date}",
+	} {
+		if got, err := RenderNameTemplate(tpl, NameFields{Title: "t", Ext: "mp4"}); err == nil {
+			t.Errorf("RenderNameTemplate(%q) = %q, want error", tpl, got)
+		}
+	}
+}
+
+func TestPagedNameTemplate(t *testing.T) {
+	tests := []struct {
+		tpl  string
+		want string
+	}{
+		{DefaultNameTemplate, "{title} P{page} {part}.{ext}"},
+		{"{uploader}/{title}", "{uploader}/{title} P{page} {part}"},
+		{"{title} P{page:02}.{ext}", "{title} P{page:02}.{ext}"},
+		{"{bvid}_{part}.{ext}", "{bvid}_{part}.{ext}"},
+		{"{cid}.{ext}", "{cid}.{ext}"},
+		{"{unknown}", "{unknown}"},
+	}
+	for _, tt := range tests {
+		if got := PagedNameTemplate(tt.tpl); got != tt.want {
+			t.Errorf("PagedNameTemplate(%q) = %q, want %q", tt.tpl, got, tt.want)
+		}
+	}
+}
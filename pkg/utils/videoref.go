@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind 视频引用指向的内容类型
+type Kind int
+
+const (
+	KindVideo  Kind = iota // 投稿视频，ID 为 BV 号
+	KindCheese             // 课堂剧集，ID 为剧集编号
+	KindSong               // 音频区单曲，ID 为音频编号
+	KindMenu               // 音频歌单，ID 为歌单编号
+)
+
+// String 返回类型名称 video、cheese、song 或 menu
+func (k Kind) String() string {
+	switch k {
+	case KindCheese:
+		return "cheese"
+	case KindSong:
+		return "song"
+	case KindMenu:
+		return "menu"
+	}
+	return "video"
+}
+
+// VideoRef 从链接或编号中解析出的视频引用
+type VideoRef struct {
+	Kind  Kind
+	ID    string        // 投稿视频为 BV 号，其余为数字编号
+	Page  int           // 分P序号（从 1 开始），0 表示未指定
+	Start time.Duration // 链接中 t= 给出的播放位置，0 表示未指定
+}
+
+var (
+	bvidPattern      = regexp.MustCompile(`BV1[0-9A-Za-z]{9}`)
+	avidPattern      = regexp.MustCompile(`(?i)(?:^|[^0-9a-z])av(\d+)`)
+	shortLinkPattern = regexp.MustCompile(`(?:https?://)?(?:b23\.tv|bili2233\.cn)/[0-9A-Za-z]+`)
+	// shortLinkInput 整个输入只是一个短链接，可带查询参数
+	shortLinkInput = regexp.MustCompile(`^(?:https?://)?(b23\.tv|bili2233\.cn)/([0-9A-Za-z]+)/?(?:[?#]\S*)?$`)
+	cheesePattern  = regexp.MustCompile(`bilibili\.com/cheese/play/ep(\d+)`)
+	audioPattern   = regexp.MustCompile(`bilibili\.com/audio/(a[um])0*([1-9]\d*)`)
+	audioIDPattern = regexp.MustCompile(`^(a[um])0*([1-9]\d*)$`)
+	// videoLinkPattern 文本中可能指向视频的片段：视频页、课堂剧集和音频的链接、短链接、BV 号、av 号
+	videoLinkPattern = regexp.MustCompile(`https?://(?:www\.|m\.)?bilibili\.com/(?:video/[^\s"'<>]+|cheese/play/ep\d+|audio/a[um]\d+)|` +
+		shortLinkPattern.String() + `|BV1[0-9A-Za-z]{9}|\bav\d+`)
+)
+
+// Key 在媒体库、文件名和界面中标识视频的字符串：投稿视频为 BV 号，
+// 课堂剧集、单曲和歌单分别为 "ep"、"au"、"am" 加编号。只用于显示和比较，不作为输入解析
+func (r VideoRef) Key() string {
+	switch r.Kind {
+	case KindCheese:
+		return "ep" + r.ID
+	case KindSong:
+		return "au" + r.ID
+	case KindMenu:
+		return "am" + r.ID
+	}
+	return r.ID
+}
+
+// NumID 返回课堂剧集、单曲和歌单的数字编号，投稿视频或编号无效时返回 0
+func (r VideoRef) NumID() int64 {
+	if r.Kind == KindVideo {
+		return 0
+	}
+	id, err := strconv.ParseInt(r.ID, 10, 64)
+	if err != nil || id <= 0 {
+		return 0
+	}
+	return id
+}
+
+// audioRef 由 "au"/"am" 前缀和编号构造单曲或歌单的引用
+func audioRef(prefix, id string) VideoRef {
+	if prefix == "am" {
+		return VideoRef{Kind: KindMenu, ID: id}
+	}
+	return VideoRef{Kind: KindSong, ID: id}
+}
+
+var liveRoomPattern = regexp.MustCompile(`live\.bilibili\.com/(?:h5/|blanc/)?(\d+)`)
+
+// ParseLiveRoom 解析房间号或 live.bilibili.com 链接中的房间号（可能是短号）
+func ParseLiveRoom(input string) (int64, bool) {
+	s := strings.TrimSpace(input)
+	if m := liveRoomPattern.FindStringSubmatch(s); m != nil {
+		s = m[1]
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// IsShortLink 判断输入是否为 b23.tv 短链接，短链接需要请求后才能得到视频页地址
+func IsShortLink(input string) bool {
+	_, ok := ShortLink(input)
+	return ok
+}
+
+// ShortLink 当整个输入是 b23.tv 或 bili2233.cn 短链接时，返回只含短链接编号的 https 地址，
+// 其余部分（包括查询参数）一律丢弃，避免请求任意地址
+func ShortLink(input string) (string, bool) {
+	m := shortLinkInput.FindStringSubmatch(strings.TrimSpace(input))
+	if m == nil {
+		return "", false
+	}
+	return "https://" + m[1] + "/" + m[2], true
+}
+
+// FindVideoLinks 找出文本中所有可能指向视频的片段，按出现顺序去重
+func FindVideoLinks(text string) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, m := range videoLinkPattern.FindAllString(text, -1) {
+		if !seen[m] {
+			seen[m] = true
+			links = append(links, m)
+		}
+	}
+	return links
+}
+
+// ParseVideoRef 从 BV 号、av 号、视频链接、课堂剧集或音频的链接以及 au、am 编号中解析视频引用，
+// 链接中的 p= 和 t= 参数分别作为分P和播放位置。番剧的剧集同样使用 ep 编号，
+// 因此课堂剧集只接受 cheese/play 链接
+func ParseVideoRef(input string) (VideoRef, bool) {
+	input = strings.TrimSpace(input)
+	var ref VideoRef
+	if m := cheesePattern.FindStringSubmatch(input); m != nil {
+		ref = VideoRef{Kind: KindCheese, ID: m[1]}
+	} else if m := audioPattern.FindStringSubmatch(input); m != nil {
+		ref = audioRef(m[1], m[2])
+	} else if m := audioIDPattern.FindStringSubmatch(input); m != nil {
+		ref = audioRef(m[1], m[2])
+	} else if m := bvidPattern.FindString(input); m != "" {
+		ref.ID = m
+	} else if m := avidPattern.FindStringSubmatch(input); m != nil {
+		aid, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || aid <= 0 {
+			return VideoRef{}, false
+		}
+		ref.ID = AVToBV(aid)
+	} else {
+		return VideoRef{}, false
+	}
+
+	_, query, ok := strings.Cut(input, "?")
+	if !ok {
+		return ref, true
+	}
+	query, _, _ = strings.Cut(query, "#")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return ref, true
+	}
+	if p, err := strconv.Atoi(values.Get("p")); err == nil && p > 0 {
+		ref.Page = p
+	}
+	if t, err := strconv.ParseFloat(values.Get("t"), 64); err == nil && t > 0 && t < math.MaxInt64/float64(time.Second) {
+		ref.Start = time.Duration(t * float64(time.Second))
+	}
+	return ref, true
+}
+
+// URL 返回带分P和播放位置参数的视频页链接
+func (r VideoRef) URL() string {
+	u := "https://www.bilibili.com/video/" + r.ID
+	switch r.Kind {
+	case KindCheese:
+		u = "https://www.bilibili.com/cheese/play/" + r.Key()
+	case KindSong, KindMenu:
+		u = "https://www.bilibili.com/audio/" + r.Key()
+	}
+	q := url.Values{}
+	if r.Page > 1 {
+		q.Set("p", strconv.Itoa(r.Page))
+	}
+	if r.Start > 0 {
+		q.Set("t", strconv.FormatFloat(r.Start.Seconds(), 'f', -1, 64))
+	}
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+const (
+	bvAlphabet = "FcwAPNKTMug3GV5Lj7EJnHpWsx4tb8haYeviqBz6rkCy12mUSDQX9RdoZf"
+	bvXorCode  = 23442827791579
+	bvMaxAID   = 1 << 51
+)
+
+// AVToBV 将 av 号转换为 BV 号
+func AVToBV(aid int64) string {
+	b := []byte("BV1000000000")
+	tmp := (bvMaxAID | aid) ^ bvXorCode
+	for i := len(b) - 1; tmp > 0 && i >= 3; i-- {
+		b[i] = bvAlphabet[tmp%58]
+		tmp /= 58
+	}
+	b[3], b[9] = b[9], b[3]
+	b[4], b[7] = b[7], b[4]
+	return string(b)
+}
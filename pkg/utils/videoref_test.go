@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVideoRef(t *testing.T) {
+	tests := []struct {
+		input string
+		want  VideoRef
+		ok    bool
+	}{
+		{"BV17x411w7KC", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"  BV17x411w7KC\n", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"av170001", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"AV170001", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"https://www.bilibili.com/video/BV17x411w7KC/?spm_id_from=333&p=2", VideoRef{ID: "BV17x411w7KC", Page: 2}, true},
+		{"https://www.bilibili.com/video/av2?p=3#reply", VideoRef{ID: "BV1xx411c7mD", Page: 3}, true},
+		{"https://www.bilibili.com/video/BV17x411w7KC?p=abc", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"https://www.bilibili.com/video/BV17x411w7KC?p=0", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"https://www.bilibili.com/video/BV17x411w7KC?p=2&t=90", VideoRef{ID: "BV17x411w7KC", Page: 2, Start: 90 * time.Second}, true},
+		{"https://www.bilibili.com/video/BV17x411w7KC/?t=12.5&spm_id_from=333", VideoRef{ID: "BV17x411w7KC", Start: 12500 * time.Millisecond}, true},
+		{"https://www.bilibili.com/video/BV17x411w7KC?t=-5", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"https://www.bilibili.com/video/BV17x411w7KC?t=1e30", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"https://www.bilibili.com/video/BV17x411w7KC?t=NaN", VideoRef{ID: "BV17x411w7KC"}, true},
+		{"https://www.bilibili.com/cheese/play/ep1234?p=2", VideoRef{Kind: KindCheese, ID: "1234", Page: 2}, true},
+		{"https://m.bilibili.com/audio/au0012", VideoRef{Kind: KindSong, ID: "12"}, true},
+		{"https://www.bilibili.com/audio/am10624", VideoRef{Kind: KindMenu, ID: "10624"}, true},
+		{"au590187", VideoRef{Kind: KindSong, ID: "590187"}, true},
+		{"am0099", VideoRef{Kind: KindMenu, ID: "99"}, true},
+		// 番剧同样使用 ep 编号，课堂剧集只接受链接
+		{"ep123", VideoRef{}, false},
+		{"au0", VideoRef{}, false},
+		{"av0", VideoRef{}, false},
+		{"BV1xx411c7m", VideoRef{}, false},
+		{"https://b23.tv/AbC123", VideoRef{}, false},
+		{"", VideoRef{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseVideoRef(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseVideoRef(%q) = %+v, %v; want %+v, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestVideoRefURL(t *testing.T) {
+	tests := []struct {
+		ref  VideoRef
+		want string
+	}{
+		{VideoRef{ID: "BV17x411w7KC"}, "https://www.bilibili.com/video/BV17x411w7KC"},
+		{VideoRef{ID: "BV17x411w7KC", Page: 1}, "https://www.bilibili.com/video/BV17x411w7KC"},
+		{VideoRef{ID: "BV17x411w7KC", Page: 3}, "https://www.bilibili.com/video/BV17x411w7KC?p=3"},
+		{VideoRef{ID: "BV17x411w7KC", Page: 2, Start: 90 * time.Second}, "https://www.bilibili.com/video/BV17x411w7KC?p=2&t=90"},
+		{VideoRef{ID: "BV17x411w7KC", Start: 1500 * time.Millisecond}, "https://www.bilibili.com/video/BV17x411w7KC?t=1.5"},
+		{VideoRef{Kind: KindCheese, ID: "1234"}, "https://www.bilibili.com/cheese/play/ep1234"},
+		{VideoRef{Kind: KindSong, ID: "12"}, "https://www.bilibili.com/audio/au12"},
+		{VideoRef{Kind: KindMenu, ID: "99"}, "https://www.bilibili.com/audio/am99"},
+	}
+	for _, tt := range tests {
+		if got := tt.ref.URL(); got != tt.want {
+			t.Errorf("%+v.URL() = %q, want %q", tt.ref, got, tt.want)
+		}
+		// 生成的链接应能解析回同一个引用
+		want := tt.ref
+		if want.Page == 1 {
+			want.Page = 0
+		}
+		if got, ok := ParseVideoRef(tt.ref.URL()); !ok || got != want {
+			t.Errorf("ParseVideoRef(%q) = %+v, %v; want %+v", tt.ref.URL(), got, ok, want)
+		}
+	}
+}
+
+func TestAVToBV(t *testing.T) {
+	tests := []struct {
+		aid  int64
+		want string
+	}{
+		{1, "BV1xx411c7mQ"},
+		{2, "BV1xx411c7mD"},
+		{170001, "BV17x411w7KC"},
+	}
+	for _, tt := range tests {
+		if got := AVToBV(tt.aid); got != tt.want {
+			t.Errorf("AVToBV(%d) = %q, want %q", tt.aid, got, tt.want)
+		}
+	}
+}
+
+func TestShortLink(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{"b23.tv/AbC123", "https://b23.tv/AbC123", true},
+		{"http://b23.tv/AbC123", "https://b23.tv/AbC123", true},
+		{" https://b23.tv/AbC/ ", "https://b23.tv/AbC", true},
+		{"https://bili2233.cn/xyz?share_source=copy", "https://bili2233.cn/xyz", true},
+		{"https://b23.tv/AbC/extra", "", false},
+		{"https://evil.example/b23.tv/AbC", "", false},
+		{"https://b23.tv.evil.example/AbC", "", false},
+		{"b23.tv/", "", false},
+		{"BV17x411w7KC", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ShortLink(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ShortLink(%q) = %q, %v; want %q, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+		if IsShortLink(tt.input) != tt.ok {
+			t.Errorf("IsShortLink(%q) = %v, want %v", tt.input, !tt.ok, tt.ok)
+		}
+	}
+}
+
+func TestFindVideoLinks(t *testing.T) {
+	text := "看这个 https://www.bilibili.com/video/BV17x411w7KC?p=2 和 https://b23.tv/AbC123，" +
+		"还有 av170001、BV17x411w7KC 以及 https://www.bilibili.com/video/BV17x411w7KC?p=2"
+	want := []string{
+		"https://www.bilibili.com/video/BV17x411w7KC?p=2",
+		"https://b23.tv/AbC123",
+		"av170001",
+		"BV17x411w7KC",
+	}
+	got := FindVideoLinks(text)
+	if len(got) != len(want) {
+		t.Fatalf("FindVideoLinks = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("FindVideoLinks[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
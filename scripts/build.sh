@@ -86,6 +86,17 @@ cat > "$BUILD_DIR/$APP_NAME.app/Contents/Info.plist" << EOF
     <true/>
     <key>LSApplicationCategoryType</key>
     <string>public.app-category.utilities</string>
+    <key>CFBundleURLTypes</key>
+    <array>
+        <dict>
+            <key>CFBundleURLName</key>
+            <string>com.dilidili.app</string>
+            <key>CFBundleURLSchemes</key>
+            <array>
+                <string>dilidili</string>
+            </array>
+        </dict>
+    </array>
     <key>NSAppTransportSecurity</key>
     <dict>
         <key>NSAllowsArbitraryLoads</key>